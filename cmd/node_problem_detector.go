@@ -76,9 +76,7 @@ func main() {
 			glog.Warningf("Duplicated monitor configuration %q", config)
 			continue
 		}
-		//raj
-		glog.Infof("SystemLogMonitorConfigPaths: %+v", config) 
-		monitors[config] = systemlogmonitor.NewSensuLogMonitorOrDie(config)
+		monitors[config] = systemlogmonitor.NewMonitorOrDie(config)
 	}
 
 	for _, config := range npdo.CustomPluginMonitorConfigPaths {
@@ -87,8 +85,6 @@ func main() {
 			glog.Warningf("Duplicated monitor configuration %q", config)
 			continue
 		}
-		//raj
-		glog.Infof("SystemLogMonitorConfigPaths: %+v", config) 
 		monitors[config] = custompluginmonitor.NewCustomPluginMonitorOrDie(config)
 	}
 	c := problemclient.NewClientOrDie(npdo)
@@ -113,8 +113,12 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 	if result.Rule.Type == types.Temp {
 		// For temporary error only generate event when exit status is above warning
 		if result.ExitStatus >= cpmtypes.NonOK {
+			severity := types.Warn
+			if result.Rule.Severity != "" {
+				severity = result.Rule.Severity
+			}
 			events = append(events, types.Event{
-				Severity:  types.Warn,
+				Severity:  severity,
 				Timestamp: timestamp,
 				Reason:    result.Rule.Reason,
 				Message:   result.Message,
@@ -154,12 +158,16 @@ func (c *customPluginMonitor) generateStatus(result cpmtypes.Result) *types.Stat
 					// change 2: Condition status change from False/Unknown to True
 					condition.Transition = timestamp
 					condition.Message = result.Message
-					events = append(events, util.GenerateConditionChangeEvent(
+					event := util.GenerateConditionChangeEvent(
 						condition.Type,
 						status,
 						result.Rule.Reason,
 						timestamp,
-					))
+					)
+					if result.Rule.Severity != "" {
+						event.Severity = result.Rule.Severity
+					}
+					events = append(events, event)
 
 					condition.Status = status
 					condition.Reason = result.Rule.Reason
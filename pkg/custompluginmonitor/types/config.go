@@ -128,6 +128,12 @@ func (cpc CustomPluginConfig) Validate() error {
 		}
 	}
 
+	for _, rule := range cpc.Rules {
+		if rule.Severity != "" && !types.IsValidSeverity(rule.Severity) {
+			return fmt.Errorf("unknown severity %q. Rule: %+v", rule.Severity, rule)
+		}
+	}
+
 	for _, rule := range cpc.Rules {
 		if _, err := os.Stat(rule.Path); os.IsNotExist(err) {
 			return fmt.Errorf("rule path %q does not exist. Rule: %+v", rule.Path, rule)
@@ -20,6 +20,8 @@ import (
 	"reflect"
 	"testing"
 	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
 )
 
 func TestCustomPluginConfigApplyConfiguration(t *testing.T) {
@@ -195,6 +197,11 @@ func TestCustomPluginConfigValidate(t *testing.T) {
 						Path:    "../plugin/test-data/ok.sh",
 						Timeout: &normalRuleTimeout,
 					},
+					{
+						Path:     "../plugin/test-data/non-ok.sh",
+						Timeout:  &normalRuleTimeout,
+						Severity: types.Critical,
+					},
 				},
 			},
 			IsError: false,
@@ -255,6 +262,25 @@ func TestCustomPluginConfigValidate(t *testing.T) {
 			},
 			IsError: true,
 		},
+		"unknown severity": {
+			Conf: CustomPluginConfig{
+				Plugin: customPluginName,
+				PluginGlobalConfig: pluginGlobalConfig{
+					InvokeInterval:  &defaultInvokeInterval,
+					Timeout:         &defaultGlobalTimeout,
+					MaxOutputLength: &defaultMaxOutputLength,
+					Concurrency:     &defaultConcurrency,
+				},
+				Rules: []*CustomRule{
+					{
+						Path:     "../plugin/test-data/ok.sh",
+						Timeout:  &normalRuleTimeout,
+						Severity: "fatal",
+					},
+				},
+			},
+			IsError: true,
+		},
 	}
 
 	for desp, utMeta := range utMetas {
@@ -46,6 +46,10 @@ type CustomRule struct {
 	Condition string `json:"condition"`
 	// Reason is the short reason of the problem.
 	Reason string `json:"reason"`
+	// Severity is the severity of the problem event. It defaults to warn for
+	// temporary problems, and info for the condition change events of
+	// permanent problems.
+	Severity types.Severity `json:"severity,omitempty"`
 	// Path is the path to the custom plugin.
 	Path string `json:"path"`
 	// Args is the args passed to the custom plugin.
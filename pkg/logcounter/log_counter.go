@@ -18,6 +18,7 @@ package logcounter
 
 import (
 	"fmt"
+	"regexp"
 	"time"
 
 	"k8s.io/apimachinery/pkg/util/clock"
@@ -39,11 +40,15 @@ const (
 type logCounter struct {
 	logCh   <-chan *systemtypes.Log
 	buffer  systemlogmonitor.LogBuffer
-	pattern string
+	pattern *regexp.Regexp
 	clock   clock.Clock
 }
 
 func NewJournaldLogCounter(options *options.LogCounterOptions) (types.LogCounter, error) {
+	pattern, err := systemlogmonitor.CompileLogPattern(options.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("error compiling pattern %q: %v", options.Pattern, err)
+	}
 	watcher := journald.NewJournaldWatcher(watchertypes.WatcherConfig{
 		Plugin:       "journald",
 		PluginConfig: map[string]string{journaldSourceKey: options.JournaldSource},
@@ -58,7 +63,7 @@ func NewJournaldLogCounter(options *options.LogCounterOptions) (types.LogCounter
 	return &logCounter{
 		logCh:   logCh,
 		buffer:  systemlogmonitor.NewLogBuffer(bufferSize),
-		pattern: options.Pattern,
+		pattern: pattern,
 		clock:   clock.RealClock{},
 	}, nil
 }
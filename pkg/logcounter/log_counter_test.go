@@ -30,10 +30,14 @@ import (
 func NewTestLogCounter(pattern string, startTime time.Time) (types.LogCounter, *clock.FakeClock, chan *systemtypes.Log) {
 	logCh := make(chan *systemtypes.Log)
 	clock := clock.NewFakeClock(startTime)
+	reg, err := systemlogmonitor.CompileLogPattern(pattern)
+	if err != nil {
+		panic(err)
+	}
 	return &logCounter{
 		logCh:   logCh,
 		buffer:  systemlogmonitor.NewLogBuffer(bufferSize),
-		pattern: pattern,
+		pattern: reg,
 		clock:   clock,
 	}, clock, logCh
 }
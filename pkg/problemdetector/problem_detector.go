@@ -76,7 +76,7 @@ func (p *problemDetector) Run() error {
 		select {
 		case status := <-ch:
 			for _, event := range status.Events {
-				p.client.Eventf(util.ConvertToAPIEventType(event.Severity), status.Source, event.Reason, event.Message)
+				p.client.Eventf(util.ConvertToAPIEventType(event.Severity), status.Source, event.Reason, "%s", event.Message)
 			}
 			for _, cdt := range status.Conditions {
 				p.conditionManager.UpdateCondition(cdt)
@@ -17,7 +17,8 @@ limitations under the License.
 package systemlogmonitor
 
 import (
-	"regexp"
+	"fmt"
+	"time"
 
 	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
@@ -48,13 +49,55 @@ func (mc *MonitorConfig) ApplyDefaultConfiguration() {
 	}
 }
 
-// ValidateRules verifies whether the regular expressions in the rules are valid.
+// ApplyConfiguration applies default configurations and parses the recovery
+// durations and windows of the rules.
+func (mc *MonitorConfig) ApplyConfiguration() error {
+	mc.ApplyDefaultConfiguration()
+	for i := range mc.Rules {
+		rule := &mc.Rules[i]
+		if rule.RecoverAfterString != "" {
+			recoverAfter, err := time.ParseDuration(rule.RecoverAfterString)
+			if err != nil {
+				return fmt.Errorf("error in parsing recovery duration %q of rule %q: %v", rule.RecoverAfterString, rule.Reason, err)
+			}
+			rule.RecoverAfter = recoverAfter
+		}
+		if rule.WindowString != "" {
+			window, err := time.ParseDuration(rule.WindowString)
+			if err != nil {
+				return fmt.Errorf("error in parsing window %q of rule %q: %v", rule.WindowString, rule.Reason, err)
+			}
+			rule.Window = window
+		}
+	}
+	return nil
+}
+
+// ValidateRules verifies whether the regular expressions, templates and settings
+// in the rules are valid.
 func (mc MonitorConfig) ValidateRules() error {
 	for _, rule := range mc.Rules {
-		_, err := regexp.Compile(rule.Pattern)
-		if err != nil {
+		if _, err := compileRule(rule); err != nil {
 			return err
 		}
+		if rule.Severity != "" && !types.IsValidSeverity(rule.Severity) {
+			return fmt.Errorf("unknown severity %q of rule %q", rule.Severity, rule.Reason)
+		}
+		if rule.RecoverAfter < 0 {
+			return fmt.Errorf("unexpected negative recovery duration %v of rule %q", rule.RecoverAfter, rule.Reason)
+		}
+		if rule.Count < 0 {
+			return fmt.Errorf("unexpected negative count %d of rule %q", rule.Count, rule.Reason)
+		}
+		if rule.Count > 1 && rule.Window <= 0 {
+			return fmt.Errorf("rule %q with count %d requires a positive window, got %v", rule.Reason, rule.Count, rule.Window)
+		}
+		if len(rule.RecoveryFields) > 0 && rule.RecoveryPattern == "" {
+			return fmt.Errorf("recovery fields require a recovery pattern, got rule %q", rule.Reason)
+		}
+		if rule.Recoverable() && rule.Type != types.Perm {
+			return fmt.Errorf("recovery is only supported by permanent rules, got rule %q of type %q", rule.Reason, rule.Type)
+		}
 	}
 	return nil
 }
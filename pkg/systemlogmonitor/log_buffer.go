@@ -17,6 +17,7 @@ limitations under the License.
 package systemlogmonitor
 
 import (
+	"bytes"
 	"regexp"
 	"strings"
 
@@ -27,8 +28,11 @@ import (
 type LogBuffer interface {
 	// Push pushes log into the log buffer.
 	Push(*types.Log)
-	// Match with regular expression in the log buffer.
-	Match(string) []*types.Log
+	// Match with regular expression in the log buffer. The regular expression
+	// must be compiled with CompileLogPattern.
+	Match(*regexp.Regexp) []*types.Log
+	// ContainsAny checks whether the log buffer contains any of the strings.
+	ContainsAny([]string) bool
 	// String returns a concatenated string of the buffered logs.
 	String() string
 }
@@ -39,6 +43,12 @@ type logBuffer struct {
 	msg     []string
 	max     int
 	current int
+	// joined is the incremental joined view of the buffered messages. Each
+	// message is followed by a '\n', and the view starts at start. New messages
+	// are appended to the end, and the messages rotated out are dropped by
+	// moving start forward.
+	joined []byte
+	start  int
 }
 
 // NewLogBuffer creates log buffer with max line number limit. Because we only match logs
@@ -50,22 +60,36 @@ func NewLogBuffer(maxLines int) *logBuffer {
 		buffer: make([]*types.Log, maxLines, maxLines),
 		msg:    make([]string, maxLines, maxLines),
 		max:    maxLines,
+		// The buffer starts with maxLines empty messages.
+		joined: bytes.Repeat([]byte{'\n'}, maxLines),
 	}
 }
 
+// CompileLogPattern compiles the regular expression to match in the log buffer.
+// The regular expression must match to the end of the log buffer.
+func CompileLogPattern(expr string) (*regexp.Regexp, error) {
+	return regexp.Compile(expr + `\z`)
+}
+
 func (b *logBuffer) Push(log *types.Log) {
+	// Drop the message rotated out, and append the new message.
+	b.start += len(b.msg[b.current%b.max]) + 1
 	b.buffer[b.current%b.max] = log
 	b.msg[b.current%b.max] = log.Message
 	b.current++
+	// Compact the joined view when the dropped messages take more than half
+	// of it, so that the joined view doesn't grow forever.
+	if b.start > len(b.joined)/2 {
+		b.joined = b.joined[:copy(b.joined, b.joined[b.start:])]
+		b.start = 0
+	}
+	b.joined = append(b.joined, log.Message...)
+	b.joined = append(b.joined, '\n')
 }
 
-// TODO(random-liu): Cache regexp if garbage collection becomes a problem someday.
-func (b *logBuffer) Match(expr string) []*types.Log {
-	// The expression should be checked outside, and it must match to the end.
-	reg := regexp.MustCompile(expr + `\z`)
-	log := b.String()
-	//fmt.Println("log_buffer: %+v", log)
-	loc := reg.FindStringIndex(log)
+func (b *logBuffer) Match(reg *regexp.Regexp) []*types.Log {
+	log := b.view()
+	loc := reg.FindIndex(log)
 	if loc == nil {
 		// No match
 		return nil
@@ -87,9 +111,24 @@ func (b *logBuffer) Match(expr string) []*types.Log {
 	return matched
 }
 
+func (b *logBuffer) ContainsAny(strs []string) bool {
+	log := b.view()
+	for _, str := range strs {
+		if bytes.Contains(log, []byte(str)) {
+			return true
+		}
+	}
+	return false
+}
+
 func (b *logBuffer) String() string {
-	logs := append(b.msg[b.current%b.max:], b.msg[:b.current%b.max]...)
-	return concatLogs(logs)
+	return string(b.view())
+}
+
+// view returns the joined view of the buffered messages without the trailing
+// '\n'. It is the same as the concatenated string of the buffered messages.
+func (b *logBuffer) view() []byte {
+	return b.joined[b.start : len(b.joined)-1]
 }
 
 // tail returns current tail index.
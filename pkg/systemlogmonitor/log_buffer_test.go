@@ -17,7 +17,9 @@ limitations under the License.
 package systemlogmonitor
 
 import (
+	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
@@ -97,7 +99,11 @@ func TestMatch(t *testing.T) {
 			b.Push(&types.Log{Message: log})
 		}
 		for i, expr := range test.exprs {
-			logs := b.Match(expr)
+			reg, err := CompileLogPattern(expr)
+			if err != nil {
+				t.Fatalf("case %d.%d: failed to compile %q: %v", c+1, i+1, expr, err)
+			}
+			logs := b.Match(reg)
 			got := []string{}
 			for _, log := range logs {
 				got = append(got, log.Message)
@@ -108,3 +114,43 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestJoinedView(t *testing.T) {
+	for _, max := range []int{1, 2, 5} {
+		b := NewLogBuffer(max)
+		var logs []string
+		for i := 0; i < 100; i++ {
+			// Messages of different lengths exercise the compaction.
+			log := strings.Repeat(fmt.Sprintf("%d", i), i%7)
+			b.Push(&types.Log{Message: log})
+			logs = append(logs, log)
+			expected := logs
+			if len(expected) > max {
+				expected = expected[len(expected)-max:]
+			} else {
+				// The buffer starts with empty messages.
+				expected = append(make([]string, max-len(expected)), expected...)
+			}
+			if got := b.String(); got != concatLogs(expected) {
+				t.Fatalf("max %d, push %d: expected %q, got %q", max, i+1, concatLogs(expected), got)
+			}
+		}
+	}
+}
+
+func BenchmarkMatch(b *testing.B) {
+	buffer := NewLogBuffer(10)
+	for i := 0; i < 10; i++ {
+		buffer.Push(&types.Log{Message: fmt.Sprintf("[%d.000000] eth0: link is up", i)})
+	}
+	reg, err := CompileLogPattern(`task \S+:\w+ blocked for more than \w+ seconds\.`)
+	if err != nil {
+		b.Fatal(err)
+	}
+	log := &types.Log{Message: "[100.000000] eth0: link is up"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buffer.Push(log)
+		buffer.Match(reg)
+	}
+}
@@ -20,78 +20,52 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"time"
-	"fmt"
+
 	"github.com/golang/glog"
-	"regexp"
 
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers"
 	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
-	systemlogtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/types"
 	"k8s.io/node-problem-detector/pkg/util"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
 type logMonitor struct {
-	watcher    watchertypes.LogWatcher
-	buffer     LogBuffer
-	config     MonitorConfig
+	watcher watchertypes.LogWatcher
+	buffer  LogBuffer
+	config  MonitorConfig
+	// rules are the compiled rules of the configuration.
+	rules []*logRule
+	// filter rejects the logs not matching any rule before matching the rules
+	// one by one. Nil disables the filter.
+	filter     *ruleFilter
 	conditions []types.Condition
 	logCh      <-chan *logtypes.Log
 	output     chan *types.Status
 	tomb       *tomb.Tomb
+	// problems are the recoverable problems currently triggering the
+	// conditions, keyed by condition type.
+	problems map[string]*conditionProblem
+	// matches are the timestamps of the matches within the window of the
+	// frequency based rules, keyed by rule index.
+	matches map[int][]time.Time
 }
 
-type SensulogMonitor struct {
-	watcher    watchertypes.SensuLogWatcher
-	buffer     LogBuffer
-	config     MonitorConfig
-	conditions []types.Condition
-	logCh      <-chan *logtypes.SensuLog
-	output     chan *types.Status
-	tomb       *tomb.Tomb
-}
-
-type check_store struct {
-	timestamp time.Time
-	check string
-	output string
-	level  string
+// conditionProblem is a recoverable permanent problem triggering a condition.
+type conditionProblem struct {
+	// rule is the rule which matched the problem.
+	rule *logRule
+	// lastMatched is the timestamp of the last log matching the problem.
+	lastMatched time.Time
 }
-var checks_status_arr =  []check_store{}
 
 // NewLogMonitorOrDie create a new LogMonitor, panic if error occurs.
-func NewSensuLogMonitorOrDie(configPath string) types.Monitor {
-	s := &SensulogMonitor{
-		tomb: tomb.NewTomb(),
-	}
-	f, err := ioutil.ReadFile(configPath)
-	if err != nil {
-		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
-	}
-	err = json.Unmarshal(f, &s.config)
-	if err != nil {
-		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
-	}
-		
-	// Apply default configurations
-	(&s.config).ApplyDefaultConfiguration()
-	err = s.config.ValidateRules()
-	if err != nil {
-		glog.Fatalf("Failed to validate matching rules %+v: %v", s.config.Rules, err)
-	}
-	glog.Infof("Finish parsing log monitor config file: %+v", s.config)
-	s.watcher = logwatchers.GetSensuLogWatcherOrDie(s.config.WatcherConfig)
-	s.buffer = NewLogBuffer(s.config.BufferSize)
-	// A 1000 size channel should be big enough.
-	s.output = make(chan *types.Status, 1000)
-	return s
-}
-
 func NewLogMonitorOrDie(configPath string) types.Monitor {
 	l := &logMonitor{
-		tomb: tomb.NewTomb(),
+		tomb:     tomb.NewTomb(),
+		problems: map[string]*conditionProblem{},
+		matches:  map[int][]time.Time{},
 	}
 	f, err := ioutil.ReadFile(configPath)
 	if err != nil {
@@ -101,13 +75,21 @@ func NewLogMonitorOrDie(configPath string) types.Monitor {
 	if err != nil {
 		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
 	}
-		
-	// Apply default configurations
-	(&l.config).ApplyDefaultConfiguration()
+
+	// Apply configurations
+	err = (&l.config).ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
 	err = l.config.ValidateRules()
 	if err != nil {
 		glog.Fatalf("Failed to validate matching rules %+v: %v", l.config.Rules, err)
 	}
+	l.rules, err = compileRules(l.config.Rules)
+	if err != nil {
+		glog.Fatalf("Failed to compile matching rules %+v: %v", l.config.Rules, err)
+	}
+	l.filter = newRuleFilter(l.rules)
 	glog.Infof("Finish parsing log monitor config file: %+v", l.config)
 	l.watcher = logwatchers.GetLogWatcherOrDie(l.config.WatcherConfig)
 	l.buffer = NewLogBuffer(l.config.BufferSize)
@@ -132,46 +114,22 @@ func (l *logMonitor) Stop() {
 	l.tomb.Stop()
 }
 
-func (s *SensulogMonitor) Stop() {
-	glog.Info("Stop log monitor")
-	s.tomb.Stop()
-}
-
-func (s *SensulogMonitor) Start() (<-chan *types.Status, error) {
-	glog.Info("Start log monitor")
-	var err error
-	s.logCh, err = s.watcher.Watch()
-	if err != nil {
-		return nil, err
-	}
-	go s.monitorLoop()
-	return s.output, nil
-}
-
-// monitorLoop is the main loop of log monitor.
-func (s *SensulogMonitor) monitorLoop() {
-	defer s.tomb.Done()
-	s.initializeStatus()
-	for {
-		select {
-		case log := <-s.logCh:
-			s.parseLog(log)
-		case <-s.tomb.Stopping():
-			s.watcher.Stop()
-			glog.Infof("Log monitor stopped")
-			return
-		}
-	}
-}
+// conditionRecoveryInterval is the interval log monitor resets the conditions
+// whose problems haven't happened again within the recovery duration.
+const conditionRecoveryInterval = 30 * time.Second
 
 // monitorLoop is the main loop of log monitor.
 func (l *logMonitor) monitorLoop() {
 	defer l.tomb.Done()
 	l.initializeStatus()
+	ticker := time.NewTicker(conditionRecoveryInterval)
+	defer ticker.Stop()
 	for {
 		select {
 		case log := <-l.logCh:
 			l.parseLog(log)
+		case now := <-ticker.C:
+			l.recoverExpiredConditions(now)
 		case <-l.tomb.Stopping():
 			l.watcher.Stop()
 			glog.Infof("Log monitor stopped")
@@ -181,146 +139,138 @@ func (l *logMonitor) monitorLoop() {
 }
 
 // parseLog parses one log line.
-//EDIT: here we need to match config file for sensu
-func (s *SensulogMonitor) parseLog(log *logtypes.SensuLog) {
+func (l *logMonitor) parseLog(log *logtypes.Log) {
 	// Once there is new log, log monitor will push it into the log buffer and try
 	// to match each rule. If any rule is matched, log monitor will report a status.
-	//fmt.Println("log monitor got new log: %+v", log)
-	// buffer: add check if new, check with old state , return changed
-	// check_map[check] = output, if old is ok & new is crit => condition is true, add check to cond, else old is crit & new is ok
-	// remove check from cond . if len(check)> 0 generate status, else "all passed"
-
-	crit_matched, _ := regexp.MatchString("CRITICAL", log.Output )
-	warn_matched, _ := regexp.MatchString("WARN", log.Output )
-	ok_matched, _   := regexp.MatchString("OK", log.Output ) 
-	
-	b := checks_status_arr[:0]
-
-	update := false
-	new_elem := true
-	for i, elem := range checks_status_arr {
-		//If previously present
-		if elem.check == log.Check {
-			new_elem = false
-			if crit_matched { 
-				elem.level = "CRITICAL"
-				elem.timestamp = log.Timestamp
-		
-			} else if warn_matched{
-				elem.level = "WARN"
-				elem.timestamp = log.Timestamp
-			} else if ok_matched{
-				//delete element if ok
-				b = append(checks_status_arr[:i], checks_status_arr[i+1:]...)
-				update = true	
-				
-			}
+	l.buffer.Push(log)
+	// Recover the conditions before matching the problems, so that a problem
+	// happening again in the same log keeps the condition.
+	for i := range l.conditions {
+		problem, ok := l.problems[l.conditions[i].Type]
+		if !ok || !problem.rule.recovered(l.buffer) {
+			continue
 		}
+		glog.Infof("Condition %q recovered from %q", l.conditions[i].Type, problem.rule.Reason)
+		status := l.recoverCondition(&l.conditions[i], log.Timestamp)
+		glog.Infof("New status generated: %+v", status)
+		l.output <- status
 	}
-			
-	if crit_matched && new_elem {
-		checks_status_arr = append(checks_status_arr, check_store{log.Timestamp, log.Check, log.Output, "CRITICAL"})
-	} else if warn_matched && new_elem {		   
-		checks_status_arr = append(checks_status_arr, check_store{log.Timestamp, log.Check, log.Output, "WARN"})
+	// Skip the rules if the log can't match any of them.
+	if l.filter != nil && !l.filter.Match(l.buffer) {
+		return
 	}
-				
-	
-	if update {
-		status := s.generateSensuStatus(b)
-		s.output <- status
-	} else {
-		status := s.generateSensuStatus(checks_status_arr)
-		s.output <- status
+	for i, rule := range l.rules {
+		matched := l.buffer.Match(rule.pattern)
+		if len(matched) == 0 || !rule.matchFields(matched[len(matched)-1].Fields) {
+			continue
+		}
+		if rule.excluded(matched) {
+			glog.V(3).Infof("Rule %q matched %q, but it is excluded", rule.Reason, generateMessage(matched))
+			continue
+		}
+		if !l.reachCount(i, rule, matched[len(matched)-1].Timestamp) {
+			continue
+		}
+		status := l.generateStatus(matched, rule)
+		if rule.Type == types.Perm {
+			if rule.Recoverable() {
+				l.problems[rule.Condition] = &conditionProblem{
+					rule:        rule,
+					lastMatched: matched[len(matched)-1].Timestamp,
+				}
+			} else {
+				// The condition is triggered by an unrecoverable problem now.
+				delete(l.problems, rule.Condition)
+			}
+		}
+		glog.Infof("New status generated: %+v", status)
+		l.output <- status
 	}
-	
 }
 
+// reachCount records a match of the rule and checks whether the matches within
+// the window reach the count of the rule. The matches are reset once they reach
+// the count, so that the problem is reported again only after another count of
+// matches.
+func (l *logMonitor) reachCount(index int, rule *logRule, timestamp time.Time) bool {
+	if rule.Count <= 1 {
+		return true
+	}
+	// Drop the matches out of the window. Logs are in time order, so the
+	// matches are sorted by timestamp.
+	matches := l.matches[index]
+	start := 0
+	for start < len(matches) && timestamp.Sub(matches[start]) >= rule.Window {
+		start++
+	}
+	matches = append(matches[start:], timestamp)
+	if len(matches) < rule.Count {
+		l.matches[index] = matches
+		return false
+	}
+	glog.V(3).Infof("Rule %q matched %d times within %v", rule.Reason, len(matches), rule.Window)
+	delete(l.matches, index)
+	return true
+}
 
-// parseLog parses one log line.
-func (l *logMonitor) parseLog(log *logtypes.Log) {
-	// Once there is new log, log monitor will push it into the log buffer and try
-	// to match each rule. If any rule is matched, log monitor will report a status.
-	l.buffer.Push(log)
-	for _, rule := range l.config.Rules {
-		matched := l.buffer.Match(rule.Pattern)
-		if len(matched) == 0 {
+// recoverExpiredConditions resets the conditions whose problems haven't happened
+// again within the recovery duration.
+func (l *logMonitor) recoverExpiredConditions(now time.Time) {
+	for i := range l.conditions {
+		problem, ok := l.problems[l.conditions[i].Type]
+		if !ok || problem.rule.RecoverAfter <= 0 || now.Sub(problem.lastMatched) < problem.rule.RecoverAfter {
 			continue
 		}
-		status := l.generateStatus(matched, rule)
+		glog.Infof("Condition %q recovered from %q, which didn't happen again since %v",
+			l.conditions[i].Type, problem.rule.Reason, problem.lastMatched)
+		status := l.recoverCondition(&l.conditions[i], now)
 		glog.Infof("New status generated: %+v", status)
 		l.output <- status
 	}
 }
 
-
-// generateSensuStatus generates status from the logs.
-func (s *SensulogMonitor) generateSensuStatus(logs_arr []check_store) *types.Status {
-	// We use the timestamp of the first log line as the timestamp of the status.
-	
-	//message := generateMessage(logs_arr)
-	
-
-	var events []types.Event
-	if len(logs_arr) > 0 {
-		for _, elem := range logs_arr {
-			events = append(events, util.GenerateSensuConditionChangeEvent(
-						elem.check,
-						"SensuCheckFailed",
-						elem.timestamp,
-			))
+// recoverCondition resets the condition to its default reason and message.
+func (l *logMonitor) recoverCondition(condition *types.Condition, timestamp time.Time) *types.Status {
+	delete(l.problems, condition.Type)
+	reason, message := "", ""
+	for _, defaultCondition := range l.config.DefaultConditions {
+		if defaultCondition.Type == condition.Type {
+			reason = defaultCondition.Reason
+			message = defaultCondition.Message
+			break
 		}
-	} 
-	
-	// For permanent error changes the condition
-	for i := range s.conditions {
-		condition := &s.conditions[i]
-		
-		// Update transition timestamp and message when the condition
-		// changes. Condition is considered to be changed only when
-		// status or reason changes.
-	
-		if len(logs_arr) == 0 {
-			condition.Transition = time.Now()
-			condition.Status = types.False
-			condition.Reason = "AllChecksFailed"
-			condition.Message = "All Sensu Checks passed"
-						
-		} else {
-			out, err := json.Marshal(logs_arr)
-    			if err != nil {
-				panic (fmt.Sprintf("log_monitor: cannot unmarshal struct %v",err))
-    				}
-			condition.Transition = time.Now()
-			condition.Message = string(out)
-			condition.Status = types.True
-			condition.Reason = "SomeChecksFailed"
-			}
 	}
+	var events []types.Event
+	if condition.Status != types.False || condition.Reason != reason {
+		condition.Transition = timestamp
+		events = append(events, util.GenerateConditionChangeEvent(
+			condition.Type,
+			types.False,
+			reason,
+			timestamp,
+		))
+	}
+	condition.Status = types.False
+	condition.Reason = reason
+	condition.Message = message
 	return &types.Status{
-		Source: "Sensu",
-		// TODO(random-liu): Aggregate events and conditions and then do periodically report.
+		Source:     l.config.Source,
 		Events:     events,
-		Conditions: s.conditions,
+		Conditions: l.conditions,
 	}
 }
 
-
 // generateStatus generates status from the logs.
-func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Rule) *types.Status {
+func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule *logRule) *types.Status {
 	// We use the timestamp of the first log line as the timestamp of the status.
 	timestamp := logs[0].Timestamp
-	message := generateMessage(logs)
 	var events []types.Event
 
 	if rule.Type == types.Temp {
 		// For temporary error only generate event
-		events = append(events, types.Event{
-			Severity:  types.Warn,
-			Timestamp: timestamp,
-			Reason:    rule.Reason,
-			Message:   message,
-		})
+		events = append(events, generateTempEvent(logs, rule))
 	} else {
+		output := generateRuleOutput(logs, rule)
 		// For permanent error changes the condition
 		for i := range l.conditions {
 			condition := &l.conditions[i]
@@ -328,18 +278,23 @@ func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Ru
 				// Update transition timestamp and message when the condition
 				// changes. Condition is considered to be changed only when
 				// status or reason changes.
-				if condition.Status == types.False || condition.Reason != rule.Reason {
+				if condition.Status == types.False || condition.Reason != output.Reason {
 					condition.Transition = timestamp
-					condition.Message = message
-					events = append(events, util.GenerateConditionChangeEvent(
+					condition.Message = output.Message
+					event := util.GenerateConditionChangeEvent(
 						condition.Type,
 						types.True,
-						rule.Reason,
+						output.Reason,
 						timestamp,
-					))
+					)
+					if rule.Severity != "" {
+						event.Severity = rule.Severity
+					}
+					event.Annotations = output.Annotations
+					events = append(events, event)
 				}
 				condition.Status = types.True
-				condition.Reason = rule.Reason
+				condition.Reason = output.Reason
 				break
 			}
 		}
@@ -352,18 +307,23 @@ func (l *logMonitor) generateStatus(logs []*logtypes.Log, rule systemlogtypes.Ru
 	}
 }
 
-// initializeStatus initializes the internal condition and also reports it to the node problem detector.
-func (s *SensulogMonitor) initializeStatus() {
-	// Initialize the default node conditions
-	s.conditions = initialConditions(s.config.DefaultConditions)
-	glog.Infof("Initialize condition generated: %+v", s.conditions)
-	// Update the initial status
-	s.output <- &types.Status{
-		Source:     s.config.Source,
-		Conditions: s.conditions,
+// generateTempEvent generates the event of a temporary problem from the logs.
+func generateTempEvent(logs []*logtypes.Log, rule *logRule) types.Event {
+	output := generateRuleOutput(logs, rule)
+	severity := types.Warn
+	if rule.Severity != "" {
+		severity = rule.Severity
+	}
+	return types.Event{
+		Severity:    severity,
+		Timestamp:   logs[0].Timestamp,
+		Reason:      output.Reason,
+		Message:     output.Message,
+		Annotations: output.Annotations,
 	}
 }
 
+// initializeStatus initializes the internal condition and also reports it to the node problem detector.
 func (l *logMonitor) initializeStatus() {
 	// Initialize the default node conditions
 	l.conditions = initialConditions(l.config.DefaultConditions)
@@ -375,7 +335,6 @@ func (l *logMonitor) initializeStatus() {
 	}
 }
 
-
 func initialConditions(defaults []types.Condition) []types.Condition {
 	conditions := make([]types.Condition, len(defaults))
 	copy(conditions, defaults)
@@ -37,6 +37,22 @@ const (
 	testConditionB = "TestConditionB"
 )
 
+func mustCompileRule(t *testing.T, rule logtypes.Rule) *logRule {
+	r, err := compileRule(rule)
+	if err != nil {
+		t.Fatalf("failed to compile rule %+v: %v", rule, err)
+	}
+	return r
+}
+
+func mustCompileRules(t *testing.T, rules []logtypes.Rule) []*logRule {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		t.Fatalf("failed to compile rules %+v: %v", rules, err)
+	}
+	return compiled
+}
+
 func TestGenerateStatus(t *testing.T) {
 	initConditions := []types.Condition{
 		{
@@ -137,13 +153,363 @@ func TestGenerateStatus(t *testing.T) {
 			// during the test.
 			conditions: append([]types.Condition{}, initConditions...),
 		}
-		got := l.generateStatus(logs, test.rule)
+		got := l.generateStatus(logs, mustCompileRule(t, test.rule))
 		if !reflect.DeepEqual(&test.expected, got) {
 			t.Errorf("case %d: expected status %+v, got %+v", c+1, test.expected, got)
 		}
 	}
 }
 
+func TestParseLogWithFields(t *testing.T) {
+	rules := []logtypes.Rule{
+		{
+			Type:   types.Temp,
+			Reason: "DiskCheckFailed",
+			Fields: map[string]string{
+				"check":  "disk_.*",
+				"status": "[12]",
+			},
+		},
+		{
+			Type:    types.Temp,
+			Reason:  "NTPCheckFailed",
+			Pattern: "CRITICAL.*",
+			Fields:  map[string]string{"check": "ntp"},
+		},
+	}
+	for c, test := range []struct {
+		log      *logtypes.Log
+		expected []string
+	}{
+		{
+			log: &logtypes.Log{
+				Message: "CRITICAL: disk 95% used",
+				Fields:  map[string]string{"check": "disk_usage", "status": "2"},
+			},
+			expected: []string{"DiskCheckFailed"},
+		},
+		{
+			// Status does not match.
+			log: &logtypes.Log{
+				Message: "OK: disk 10% used",
+				Fields:  map[string]string{"check": "disk_usage", "status": "0"},
+			},
+		},
+		{
+			// Field must match the whole value.
+			log: &logtypes.Log{
+				Message: "CRITICAL: ntp offset too large",
+				Fields:  map[string]string{"check": "ntp_drift", "status": "2"},
+			},
+		},
+		{
+			// Both pattern and fields match.
+			log: &logtypes.Log{
+				Message: "CRITICAL: ntp offset too large",
+				Fields:  map[string]string{"check": "ntp", "status": "2"},
+			},
+			expected: []string{"NTPCheckFailed"},
+		},
+		{
+			// Plain log lines have no fields.
+			log:      &logtypes.Log{Message: "CRITICAL: ntp offset too large"},
+			expected: nil,
+		},
+	} {
+		l := &logMonitor{
+			config: MonitorConfig{
+				Source: testSource,
+				Rules:  rules,
+			},
+			rules:  mustCompileRules(t, rules),
+			buffer: NewLogBuffer(1),
+			output: make(chan *types.Status, len(rules)),
+		}
+		l.parseLog(test.log)
+		close(l.output)
+		var got []string
+		for status := range l.output {
+			for _, event := range status.Events {
+				got = append(got, event.Reason)
+			}
+		}
+		assert.Equal(t, test.expected, got, "case %d", c+1)
+	}
+}
+
+func TestConditionRecovery(t *testing.T) {
+	config := MonitorConfig{
+		Source: testSource,
+		DefaultConditions: []types.Condition{
+			{Type: testConditionA, Reason: "DefaultA", Message: "default message A"},
+			{Type: testConditionB, Reason: "DefaultB", Message: "default message B"},
+		},
+		Rules: []logtypes.Rule{
+			{
+				Type:            types.Perm,
+				Condition:       testConditionA,
+				Reason:          "ProblemA",
+				Pattern:         "problem A.*",
+				RecoveryPattern: "recovered A.*",
+				RecoveryFields:  map[string]string{"SOURCE": "a"},
+			},
+			{
+				Type:               types.Perm,
+				Condition:          testConditionB,
+				Reason:             "ProblemB",
+				Pattern:            "problem B.*",
+				RecoverAfterString: "10m",
+			},
+		},
+	}
+	assert.NoError(t, (&config).ApplyConfiguration())
+	assert.NoError(t, config.ValidateRules())
+	l := &logMonitor{
+		config:     config,
+		rules:      mustCompileRules(t, config.Rules),
+		conditions: initialConditions(config.DefaultConditions),
+		buffer:     NewLogBuffer(1),
+		output:     make(chan *types.Status, 10),
+		problems:   map[string]*conditionProblem{},
+	}
+
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1000, 0), Message: "problem A happened"})
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1000, 0), Message: "problem B happened"})
+	<-l.output
+	status := <-l.output
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, types.True, status.Conditions[1].Status)
+
+	// Unrelated logs don't recover the conditions.
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1100, 0), Message: "recovered B"})
+	assert.Len(t, l.output, 0)
+
+	// The recovery is scoped by the recovery fields.
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1150, 0), Message: "recovered A", Fields: map[string]string{"SOURCE": "b"}})
+	assert.Len(t, l.output, 0)
+
+	// The recovery pattern resets condition A.
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1200, 0), Message: "recovered A", Fields: map[string]string{"SOURCE": "a"}})
+	status = <-l.output
+	assert.Equal(t, []types.Event{util.GenerateConditionChangeEvent(testConditionA, types.False, "DefaultA", time.Unix(1200, 0))}, status.Events)
+	assert.Equal(t, types.Condition{
+		Type:       testConditionA,
+		Status:     types.False,
+		Transition: time.Unix(1200, 0),
+		Reason:     "DefaultA",
+		Message:    "default message A",
+	}, status.Conditions[0])
+	assert.Equal(t, types.True, status.Conditions[1].Status)
+
+	// The condition is not recovered again.
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1300, 0), Message: "recovered A", Fields: map[string]string{"SOURCE": "a"}})
+	assert.Len(t, l.output, 0)
+
+	// Condition B is reset when problem B doesn't happen again within 10 minutes.
+	l.recoverExpiredConditions(time.Unix(1000, 0).Add(9 * time.Minute))
+	assert.Len(t, l.output, 0)
+	l.parseLog(&logtypes.Log{Timestamp: time.Unix(1000, 0).Add(5 * time.Minute), Message: "problem B again"})
+	<-l.output
+	l.recoverExpiredConditions(time.Unix(1000, 0).Add(14 * time.Minute))
+	assert.Len(t, l.output, 0)
+	l.recoverExpiredConditions(time.Unix(1000, 0).Add(15 * time.Minute))
+	status = <-l.output
+	assert.Equal(t, types.False, status.Conditions[1].Status)
+	assert.Equal(t, "DefaultB", status.Conditions[1].Reason)
+	assert.Equal(t, "default message B", status.Conditions[1].Message)
+	assert.Len(t, status.Events, 1)
+	assert.Empty(t, l.problems)
+}
+
+func TestValidateRecoveryRules(t *testing.T) {
+	for desc, rule := range map[string]logtypes.Rule{
+		"invalid recovery pattern":   {Type: types.Perm, RecoveryPattern: "recovered("},
+		"negative recovery":          {Type: types.Perm, RecoverAfter: -time.Minute},
+		"recovery of temporary rule": {Type: types.Temp, RecoveryPattern: "recovered"},
+		"invalid recovery field":     {Type: types.Perm, RecoveryPattern: "recovered", RecoveryFields: map[string]string{"SOURCE": "("}},
+		"recovery fields only":       {Type: types.Perm, RecoveryFields: map[string]string{"SOURCE": "a"}},
+	} {
+		assert.Error(t, MonitorConfig{Rules: []logtypes.Rule{rule}}.ValidateRules(), desc)
+	}
+	assert.Error(t, (&MonitorConfig{Rules: []logtypes.Rule{{RecoverAfterString: "10"}}}).ApplyConfiguration())
+}
+
+func TestFrequencyRules(t *testing.T) {
+	config := MonitorConfig{
+		Source: testSource,
+		Rules: []logtypes.Rule{
+			{
+				Type:         types.Temp,
+				Reason:       "FrequentProblem",
+				Pattern:      "problem.*",
+				Count:        3,
+				WindowString: "10m",
+			},
+		},
+	}
+	assert.NoError(t, (&config).ApplyConfiguration())
+	assert.NoError(t, config.ValidateRules())
+	l := &logMonitor{
+		config:  config,
+		rules:   mustCompileRules(t, config.Rules),
+		buffer:  NewLogBuffer(1),
+		output:  make(chan *types.Status, 10),
+		matches: map[int][]time.Time{},
+	}
+	start := time.Unix(1000, 0)
+	for c, test := range []struct {
+		offset   time.Duration
+		message  string
+		reported bool
+	}{
+		{offset: 0, message: "problem 1"},
+		{offset: time.Minute, message: "unrelated"},
+		{offset: 2 * time.Minute, message: "problem 2"},
+		// The first match is out of the window.
+		{offset: 10 * time.Minute, message: "problem 3"},
+		{offset: 11 * time.Minute, message: "problem 4", reported: true},
+		// The matches are reset after the problem is reported.
+		{offset: 12 * time.Minute, message: "problem 5"},
+		{offset: 13 * time.Minute, message: "problem 6"},
+		{offset: 14 * time.Minute, message: "problem 7", reported: true},
+	} {
+		l.parseLog(&logtypes.Log{Timestamp: start.Add(test.offset), Message: test.message})
+		if !test.reported {
+			assert.Len(t, l.output, 0, "case %d", c+1)
+			continue
+		}
+		if assert.Len(t, l.output, 1, "case %d", c+1) {
+			status := <-l.output
+			assert.Equal(t, []types.Event{{
+				Severity:  types.Warn,
+				Timestamp: start.Add(test.offset),
+				Reason:    "FrequentProblem",
+				Message:   test.message,
+			}}, status.Events, "case %d", c+1)
+		}
+	}
+
+	for desc, rule := range map[string]logtypes.Rule{
+		"negative count":       {Type: types.Temp, Count: -1},
+		"count without window": {Type: types.Temp, Count: 2},
+	} {
+		assert.Error(t, MonitorConfig{Rules: []logtypes.Rule{rule}}.ValidateRules(), desc)
+	}
+	assert.Error(t, (&MonitorConfig{Rules: []logtypes.Rule{{Count: 2, WindowString: "10"}}}).ApplyConfiguration())
+}
+
+func TestRuleTemplates(t *testing.T) {
+	logs := []*logtypes.Log{
+		{
+			Timestamp: time.Unix(1000, 0),
+			Message:   "Kill process 1234 (nginx) score 999 or sacrifice child",
+		},
+		{
+			Timestamp: time.Unix(1001, 0),
+			Message:   "Killed process 1234 (nginx) total-vm:1024kB",
+			Fields:    map[string]string{"FILE": "/var/log/kern.log", "process": "shadowed"},
+		},
+	}
+	pattern := `Kill process (?P<pid>\d+) \((?P<process>\S+)\) score \d+ or sacrifice child\nKilled process \d+ .*`
+	for desc, test := range map[string]struct {
+		rule     logtypes.Rule
+		expected types.Event
+	}{
+		"named capture groups": {
+			rule: logtypes.Rule{
+				Type:    types.Temp,
+				Reason:  "OOMKilling",
+				Pattern: pattern,
+				Message: "OOMKilling process {{.process}} ({{.pid}})",
+				Annotations: map[string]string{
+					"process": "{{.process}}",
+					"unknown": "{{.unknown}}",
+				},
+			},
+			expected: types.Event{
+				Severity:    types.Warn,
+				Timestamp:   time.Unix(1000, 0),
+				Reason:      "OOMKilling",
+				Message:     "OOMKilling process nginx (1234)",
+				Annotations: map[string]string{"process": "nginx", "unknown": ""},
+			},
+		},
+		"templated reason and matched logs": {
+			rule: logtypes.Rule{
+				Type:    types.Temp,
+				Reason:  "{{if eq .process \"nginx\"}}NginxOOMKilling{{else}}OOMKilling{{end}}",
+				Pattern: pattern,
+				Message: "{{.Message}}",
+			},
+			expected: types.Event{
+				Severity:  types.Warn,
+				Timestamp: time.Unix(1000, 0),
+				Reason:    "NginxOOMKilling",
+				Message:   "Kill process 1234 (nginx) score 999 or sacrifice child\nKilled process 1234 (nginx) total-vm:1024kB",
+			},
+		},
+		"structured fields of the last log": {
+			rule: logtypes.Rule{
+				Type:    types.Temp,
+				Reason:  "OOMKilling",
+				Pattern: pattern,
+				Message: "process {{.process}} is killed in {{.FILE}}",
+			},
+			expected: types.Event{
+				Severity:  types.Warn,
+				Timestamp: time.Unix(1000, 0),
+				Reason:    "OOMKilling",
+				Message:   "process nginx is killed in /var/log/kern.log",
+			},
+		},
+		"failed template falls back": {
+			rule: logtypes.Rule{
+				Type:    types.Temp,
+				Reason:  "OOMKilling",
+				Pattern: pattern,
+				Message: "{{index .Message 100}}",
+			},
+			expected: types.Event{
+				Severity:  types.Warn,
+				Timestamp: time.Unix(1000, 0),
+				Reason:    "OOMKilling",
+				Message:   "Kill process 1234 (nginx) score 999 or sacrifice child\nKilled process 1234 (nginx) total-vm:1024kB",
+			},
+		},
+	} {
+		assert.NoError(t, MonitorConfig{Rules: []logtypes.Rule{test.rule}}.ValidateRules(), desc)
+		l := &logMonitor{config: MonitorConfig{Source: testSource}}
+		status := l.generateStatus(logs, mustCompileRule(t, test.rule))
+		assert.Equal(t, []types.Event{test.expected}, status.Events, desc)
+	}
+
+	// The templated reason and message are set in the condition.
+	l := &logMonitor{
+		config:     MonitorConfig{Source: testSource},
+		conditions: initialConditions([]types.Condition{{Type: testConditionA}}),
+	}
+	status := l.generateStatus(logs, mustCompileRule(t, logtypes.Rule{
+		Type:        types.Perm,
+		Condition:   testConditionA,
+		Reason:      "OOMKilling",
+		Pattern:     pattern,
+		Message:     "process {{.process}} is killed",
+		Annotations: map[string]string{"pid": "{{.pid}}"},
+	}))
+	assert.Equal(t, "process nginx is killed", status.Conditions[0].Message)
+	if assert.Len(t, status.Events, 1) {
+		assert.Equal(t, map[string]string{"pid": "1234"}, status.Events[0].Annotations)
+	}
+
+	for desc, rule := range map[string]logtypes.Rule{
+		"invalid reason":     {Type: types.Temp, Reason: "{{.process"},
+		"invalid message":    {Type: types.Temp, Message: "{{end}}"},
+		"invalid annotation": {Type: types.Temp, Annotations: map[string]string{"process": "{{"}},
+	} {
+		assert.Error(t, MonitorConfig{Rules: []logtypes.Rule{rule}}.ValidateRules(), desc)
+	}
+}
+
 func TestGoroutineLeak(t *testing.T) {
 	orignal := runtime.NumGoroutine()
 	f := watchertest.NewFakeLogWatcher(10)
@@ -153,3 +519,210 @@ func TestGoroutineLeak(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, orignal, runtime.NumGoroutine())
 }
+
+func TestRuleSeverity(t *testing.T) {
+	logs := []*logtypes.Log{{Timestamp: time.Unix(1000, 0), Message: "test message"}}
+	for desc, test := range map[string]struct {
+		rule     logtypes.Rule
+		expected types.Severity
+	}{
+		"temporary default":  {rule: logtypes.Rule{Type: types.Temp, Reason: "A"}, expected: types.Warn},
+		"temporary critical": {rule: logtypes.Rule{Type: types.Temp, Reason: "A", Severity: types.Critical}, expected: types.Critical},
+		"permanent default":  {rule: logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "A"}, expected: types.Info},
+		"permanent error":    {rule: logtypes.Rule{Type: types.Perm, Condition: testConditionA, Reason: "A", Severity: types.Error}, expected: types.Error},
+	} {
+		assert.NoError(t, MonitorConfig{Rules: []logtypes.Rule{test.rule}}.ValidateRules(), desc)
+		l := &logMonitor{
+			config:     MonitorConfig{Source: testSource},
+			conditions: initialConditions([]types.Condition{{Type: testConditionA}}),
+		}
+		status := l.generateStatus(logs, mustCompileRule(t, test.rule))
+		if assert.Len(t, status.Events, 1, desc) {
+			assert.Equal(t, test.expected, status.Events[0].Severity, desc)
+		}
+	}
+	assert.Error(t, MonitorConfig{Rules: []logtypes.Rule{{Type: types.Temp, Severity: "fatal"}}}.ValidateRules())
+}
+
+func TestExcludePatternsAndScoping(t *testing.T) {
+	rules := []logtypes.Rule{
+		{
+			Type:            types.Temp,
+			Reason:          "UnregisterNetDevice",
+			Pattern:         `unregister_netdevice: waiting for \w+ to become free.*`,
+			ExcludePatterns: []string{`waiting for veth\w+`},
+		},
+		{
+			Type:    types.Temp,
+			Reason:  "DockerError",
+			Pattern: `level=error.*`,
+			Fields: map[string]string{
+				"_SYSTEMD_UNIT": "docker.service",
+				"PRIORITY":      "[0-3]",
+			},
+		},
+	}
+	assert.NoError(t, MonitorConfig{Rules: rules}.ValidateRules())
+	for c, test := range []struct {
+		log      *logtypes.Log
+		expected []string
+	}{
+		{
+			log:      &logtypes.Log{Message: "unregister_netdevice: waiting for lo to become free. Usage count = 1"},
+			expected: []string{"UnregisterNetDevice"},
+		},
+		{
+			// Expected veth teardown is excluded.
+			log: &logtypes.Log{Message: "unregister_netdevice: waiting for veth1a2b3c to become free. Usage count = 1"},
+		},
+		{
+			log: &logtypes.Log{
+				Message: `level=error msg="failed to start container"`,
+				Fields:  map[string]string{"_SYSTEMD_UNIT": "docker.service", "PRIORITY": "3"},
+			},
+			expected: []string{"DockerError"},
+		},
+		{
+			// Other units are out of scope.
+			log: &logtypes.Log{
+				Message: `level=error msg="failed to pull image"`,
+				Fields:  map[string]string{"_SYSTEMD_UNIT": "containerd.service", "PRIORITY": "3"},
+			},
+		},
+		{
+			// Lower priorities are out of scope.
+			log: &logtypes.Log{
+				Message: `level=error msg="retrying"`,
+				Fields:  map[string]string{"_SYSTEMD_UNIT": "docker.service", "PRIORITY": "6"},
+			},
+		},
+	} {
+		l := &logMonitor{
+			config: MonitorConfig{Source: testSource, Rules: rules},
+			rules:  mustCompileRules(t, rules),
+			buffer: NewLogBuffer(1),
+			output: make(chan *types.Status, len(rules)),
+		}
+		l.parseLog(test.log)
+		close(l.output)
+		var got []string
+		for status := range l.output {
+			for _, event := range status.Events {
+				got = append(got, event.Reason)
+			}
+		}
+		assert.Equal(t, test.expected, got, "case %d", c+1)
+	}
+	assert.Error(t, MonitorConfig{Rules: []logtypes.Rule{{Type: types.Temp, ExcludePatterns: []string{"veth("}}}}.ValidateRules())
+}
+
+func TestMinPriority(t *testing.T) {
+	for desc, test := range map[string]struct {
+		minPriority string
+		priority    string
+		matched     bool
+	}{
+		"more severe":          {minPriority: "warning", priority: "3", matched: true},
+		"equally severe":       {minPriority: "4", priority: "4", matched: true},
+		"less severe":          {minPriority: "warning", priority: "6"},
+		"missing priority":     {minPriority: "err"},
+		"no minimum priority":  {priority: "7", matched: true},
+		"no priority required": {matched: true},
+	} {
+		rules := []logtypes.Rule{{Type: types.Temp, Reason: "Oops", Pattern: "oops", MinPriority: test.minPriority}}
+		assert.NoError(t, MonitorConfig{Rules: rules}.ValidateRules(), desc)
+		l := &logMonitor{
+			config: MonitorConfig{Source: testSource, Rules: rules},
+			rules:  mustCompileRules(t, rules),
+			buffer: NewLogBuffer(1),
+			output: make(chan *types.Status, 1),
+		}
+		log := &logtypes.Log{Message: "oops"}
+		if test.priority != "" {
+			log.Fields = map[string]string{"PRIORITY": test.priority}
+		}
+		l.parseLog(log)
+		assert.Equal(t, test.matched, len(l.output) == 1, desc)
+	}
+	for _, priority := range []string{"8", "-1", "warn", "WARNING"} {
+		rules := []logtypes.Rule{{Type: types.Temp, Reason: "Oops", Pattern: "oops", MinPriority: priority}}
+		assert.Error(t, MonitorConfig{Rules: rules}.ValidateRules(), priority)
+	}
+}
+
+func TestRuleFilter(t *testing.T) {
+	rules := mustCompileRules(t, []logtypes.Rule{
+		{Type: types.Temp, Reason: "A", Pattern: "problem a.*"},
+		{Type: types.Temp, Reason: "B", Pattern: `problem \d+\nproblem b`},
+		{Type: types.Temp, Reason: "C", Pattern: `oops: \w+`},
+	})
+	filter := newRuleFilter(rules)
+	if !assert.NotNil(t, filter) {
+		return
+	}
+	// "problem a" contains "problem ", so it is not needed.
+	assert.Equal(t, []string{"oops: ", "problem "}, filter.prefixes)
+	for _, test := range []struct {
+		logs    []string
+		matched bool
+	}{
+		{logs: []string{"problem a"}, matched: true},
+		{logs: []string{"problem 1", "problem b"}, matched: true},
+		{logs: []string{"kernel oops: bug"}, matched: true},
+		{logs: []string{"unrelated", "unrelated"}, matched: false},
+	} {
+		b := NewLogBuffer(2)
+		for _, log := range test.logs {
+			b.Push(&logtypes.Log{Message: log})
+		}
+		assert.Equal(t, test.matched, filter.Match(b), "logs %q", test.logs)
+	}
+	assert.Nil(t, newRuleFilter(rules[:1]))
+	// Rules without literal prefix disable the filter.
+	assert.Nil(t, newRuleFilter(append(rules, mustCompileRule(t, logtypes.Rule{Pattern: "(?i)oops"}))))
+}
+
+// newBenchmarkLogMonitor creates a log monitor with 40 rules similar to the
+// kernel monitor rules.
+func newBenchmarkLogMonitor(b *testing.B, filter bool) *logMonitor {
+	var rules []logtypes.Rule
+	for i := 0; i < 10; i++ {
+		rules = append(rules,
+			logtypes.Rule{Type: types.Temp, Reason: "OOMKilling", Pattern: fmt.Sprintf(`Kill process \d+ (.+) score \d+ or sacrifice child %d\nKilled process \d+ (.+) total-vm:\d+kB, anon-rss:\d+kB, file-rss:\d+kB.*`, i)},
+			logtypes.Rule{Type: types.Temp, Reason: "TaskHung", Pattern: fmt.Sprintf(`task \S+:\w+ blocked for more than %d seconds\.`, i)},
+			logtypes.Rule{Type: types.Temp, Reason: "KernelOops", Pattern: fmt.Sprintf(`BUG: unable to handle kernel NULL pointer dereference at %d.*`, i)},
+			logtypes.Rule{Type: types.Temp, Reason: "Ext4Error", Pattern: fmt.Sprintf(`EXT4-fs error \(device sd%d\).*`, i)},
+		)
+	}
+	compiled, err := compileRules(rules)
+	if err != nil {
+		b.Fatal(err)
+	}
+	l := &logMonitor{
+		config: MonitorConfig{Source: testSource, Rules: rules},
+		rules:  compiled,
+		buffer: NewLogBuffer(10),
+		output: make(chan *types.Status, 1),
+	}
+	if filter {
+		l.filter = newRuleFilter(compiled)
+	}
+	return l
+}
+
+func benchmarkParseLog(b *testing.B, filter bool) {
+	l := newBenchmarkLogMonitor(b, filter)
+	log := &logtypes.Log{Message: "[12345.678901] IPv6: ADDRCONF(NETDEV_CHANGE): veth1234abcd: link becomes ready"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.parseLog(log)
+	}
+}
+
+func BenchmarkParseLog(b *testing.B) {
+	benchmarkParseLog(b, true)
+}
+
+func BenchmarkParseLogWithoutFilter(b *testing.B) {
+	benchmarkParseLog(b, false)
+}
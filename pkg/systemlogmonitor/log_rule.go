@@ -0,0 +1,261 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// logRule is a rule with the regular expressions and templates compiled, so
+// that they are compiled only once when the configuration is loaded.
+type logRule struct {
+	logtypes.Rule
+	// pattern is the compiled pattern to match in the log buffer.
+	pattern *regexp.Regexp
+	// excludePatterns are the compiled exclusion patterns.
+	excludePatterns []*regexp.Regexp
+	// fields are the compiled regular expressions of the fields, which must
+	// match the whole field value.
+	fields map[string]*regexp.Regexp
+	// minPriority is the parsed minimum priority, or -1 if the rule has no
+	// minimum priority.
+	minPriority int
+	// recoveryPattern is the compiled recovery pattern to match in the log
+	// buffer, or nil if the rule has no recovery pattern.
+	recoveryPattern *regexp.Regexp
+	// recoveryFields are the compiled regular expressions of the recovery
+	// fields.
+	recoveryFields map[string]*regexp.Regexp
+	// reason is the reason template.
+	reason *template.Template
+	// message is the message template, or nil if the rule has no message.
+	message *template.Template
+	// annotations are the annotation templates keyed by annotation name.
+	annotations map[string]*template.Template
+}
+
+// compileRule compiles the regular expressions and templates of the rule.
+func compileRule(rule logtypes.Rule) (*logRule, error) {
+	r := &logRule{Rule: rule, minPriority: -1}
+	var err error
+	if r.pattern, err = CompileLogPattern(rule.Pattern); err != nil {
+		return nil, err
+	}
+	for _, expr := range rule.ExcludePatterns {
+		reg, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		r.excludePatterns = append(r.excludePatterns, reg)
+	}
+	if r.fields, err = compileFields(rule.Fields); err != nil {
+		return nil, err
+	}
+	if rule.MinPriority != "" {
+		if r.minPriority, err = parsePriority(rule.MinPriority); err != nil {
+			return nil, err
+		}
+	}
+	if rule.RecoveryPattern != "" {
+		if r.recoveryPattern, err = CompileLogPattern(rule.RecoveryPattern); err != nil {
+			return nil, err
+		}
+	}
+	if r.recoveryFields, err = compileFields(rule.RecoveryFields); err != nil {
+		return nil, err
+	}
+	if r.reason, err = parseRuleTemplate("reason", rule.Reason); err != nil {
+		return nil, fmt.Errorf("invalid reason template %q: %v", rule.Reason, err)
+	}
+	if rule.Message != "" {
+		if r.message, err = parseRuleTemplate("message", rule.Message); err != nil {
+			return nil, fmt.Errorf("invalid message template %q: %v", rule.Message, err)
+		}
+	}
+	if len(rule.Annotations) > 0 {
+		r.annotations = map[string]*template.Template{}
+		for key, value := range rule.Annotations {
+			if r.annotations[key], err = parseRuleTemplate(key, value); err != nil {
+				return nil, fmt.Errorf("invalid annotation template %q of %q: %v", value, key, err)
+			}
+		}
+	}
+	return r, nil
+}
+
+// compileFields compiles the regular expressions of the fields, which must
+// match the whole field value. It returns nil if there are no fields.
+func compileFields(fields map[string]string) (map[string]*regexp.Regexp, error) {
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	compiled := map[string]*regexp.Regexp{}
+	for name, expr := range fields {
+		reg, err := regexp.Compile(`\A(?:` + expr + `)\z`)
+		if err != nil {
+			return nil, err
+		}
+		compiled[name] = reg
+	}
+	return compiled, nil
+}
+
+// compileRules compiles the rules.
+func compileRules(rules []logtypes.Rule) ([]*logRule, error) {
+	var compiled []*logRule
+	for _, rule := range rules {
+		r, err := compileRule(rule)
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// ruleFilter rejects the logs which can't match any rule with the literal
+// prefixes of the rule patterns. A rule pattern can only match the log buffer
+// when the log buffer contains its literal prefix, and scanning the log buffer
+// for a few literals is much cheaper than running every rule pattern. Combining
+// the patterns into one regular expression doesn't help, because it defeats
+// the literal prefix optimization of the regexp package.
+type ruleFilter struct {
+	// prefixes are the deduplicated literal prefixes of the rule patterns.
+	prefixes []string
+}
+
+// newRuleFilter creates the filter of the rules. It returns nil if there are
+// less than 2 rules, or any rule pattern has no literal prefix, e.g. "(?i)oops"
+// or "\\w+ oops".
+func newRuleFilter(rules []*logRule) *ruleFilter {
+	if len(rules) < 2 {
+		return nil
+	}
+	var prefixes []string
+	for _, rule := range rules {
+		prefix, _ := rule.pattern.LiteralPrefix()
+		if prefix == "" {
+			glog.V(3).Infof("Rule %q has no literal prefix, disable the rule filter", rule.Reason)
+			return nil
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	// A log buffer containing a prefix also contains the prefixes it contains,
+	// so only the prefixes not containing other prefixes are needed.
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) < len(prefixes[j]) })
+	f := &ruleFilter{}
+	for _, prefix := range prefixes {
+		needed := true
+		for _, p := range f.prefixes {
+			if strings.Contains(prefix, p) {
+				needed = false
+				break
+			}
+		}
+		if needed {
+			f.prefixes = append(f.prefixes, prefix)
+		}
+	}
+	return f
+}
+
+// Match checks whether any rule may match the log buffer.
+func (f *ruleFilter) Match(buffer LogBuffer) bool {
+	return buffer.ContainsAny(f.prefixes)
+}
+
+// excluded checks whether the matched logs match any exclusion pattern of the
+// rule.
+func (r *logRule) excluded(logs []*logtypes.Log) bool {
+	if len(r.excludePatterns) == 0 {
+		return false
+	}
+	message := generateMessage(logs)
+	for _, reg := range r.excludePatterns {
+		if reg.MatchString(message) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchFields checks whether the structured fields of the log match all the
+// field regular expressions and the minimum priority of the rule.
+func (r *logRule) matchFields(fields map[string]string) bool {
+	if !fieldsMatch(r.fields, fields) {
+		return false
+	}
+	if r.minPriority >= 0 {
+		priority, err := strconv.Atoi(fields[priorityField])
+		if err != nil || priority > r.minPriority {
+			return false
+		}
+	}
+	return true
+}
+
+// recovered checks whether the log buffer matches the recovery pattern, and
+// the structured fields of the last matched log match the recovery fields of
+// the rule.
+func (r *logRule) recovered(buffer LogBuffer) bool {
+	if r.recoveryPattern == nil {
+		return false
+	}
+	matched := buffer.Match(r.recoveryPattern)
+	return len(matched) > 0 && fieldsMatch(r.recoveryFields, matched[len(matched)-1].Fields)
+}
+
+// fieldsMatch checks whether the structured fields match all the field regular
+// expressions. A missing field is treated as an empty value.
+func fieldsMatch(regs map[string]*regexp.Regexp, fields map[string]string) bool {
+	for name, reg := range regs {
+		if !reg.MatchString(fields[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// priorityField is the field of the syslog priority of the log.
+const priorityField = "PRIORITY"
+
+// priorityNames are the syslog priority names indexed by priority, the same as
+// journalctl.
+var priorityNames = []string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// parsePriority parses a syslog priority name or number.
+func parsePriority(s string) (int, error) {
+	for priority, name := range priorityNames {
+		if s == name {
+			return priority, nil
+		}
+	}
+	priority, err := strconv.Atoi(s)
+	if err != nil || priority < 0 || priority >= len(priorityNames) {
+		return 0, fmt.Errorf("invalid priority %q, expect one of %v or 0-%d", s, priorityNames, len(priorityNames)-1)
+	}
+	return priority, nil
+}
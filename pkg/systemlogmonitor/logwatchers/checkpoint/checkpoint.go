@@ -0,0 +1,133 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package checkpoint persists the read position of the log watchers, so that
+// a log watcher can resume where it left off after restart.
+package checkpoint
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint is the read position of a log watcher.
+type Checkpoint struct {
+	// Inode is the inode of the log file being read.
+	Inode uint64 `json:"inode,omitempty"`
+	// Offset is the offset of the next log line to read in the log file.
+	Offset int64 `json:"offset,omitempty"`
+	// Cursor is the journal cursor of the last journal entry read.
+	Cursor string `json:"cursor,omitempty"`
+	// Timestamp is the timestamp of the last log read.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Load loads the checkpoint from the checkpoint file.
+func Load(path string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Checkpoint{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint %q: %v", path, err)
+	}
+	return c, nil
+}
+
+// Save saves the checkpoint to the checkpoint file. The checkpoint is written
+// to a temporary file and renamed to the checkpoint file, so that a crash in
+// the middle doesn't leave a corrupted checkpoint.
+func Save(path string, c *Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint %+v: %v", c, err)
+	}
+	f, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path))
+	if err != nil {
+		return fmt.Errorf("failed to create temporary checkpoint file: %v", err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write checkpoint %q: %v", f.Name(), err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close checkpoint %q: %v", f.Name(), err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return fmt.Errorf("failed to rename checkpoint %q to %q: %v", f.Name(), path, err)
+	}
+	return nil
+}
+
+// Tracker tracks the checkpoints after the logs a log watcher sends to its log
+// channel, so that only the logs consumed from the log channel are covered by
+// the saved checkpoint. The logs still buffered in the log channel when the
+// log watcher stops would be skipped after restart otherwise.
+type Tracker struct {
+	// consumed is the checkpoint after the last log consumed, or nil if
+	// unknown.
+	consumed *Checkpoint
+	// pending are the checkpoints after the logs not consumed yet, oldest
+	// first.
+	pending []*Checkpoint
+}
+
+// NewTracker creates a tracker starting from the checkpoint, which may be nil.
+func NewTracker(c *Checkpoint) *Tracker {
+	return &Tracker{consumed: c}
+}
+
+// Sent records the checkpoint after a log sent to the log channel. buffered
+// is the number of logs in the log channel after the log is sent.
+func (t *Tracker) Sent(c *Checkpoint, buffered int) {
+	t.pending = append(t.pending, c)
+	t.trim(buffered)
+}
+
+// Skipped records the checkpoint after a log not sent to the log channel, e.g.
+// a log before the start time. It is consumed once the logs sent before it
+// are consumed. buffered is the number of logs in the log channel.
+func (t *Tracker) Skipped(c *Checkpoint, buffered int) {
+	t.trim(buffered)
+	if len(t.pending) == 0 {
+		t.consumed = c
+		return
+	}
+	t.pending[len(t.pending)-1] = c
+}
+
+// Consumed returns the checkpoint after the last log consumed from the log
+// channel, or nil if unknown. buffered is the number of logs in the log
+// channel.
+func (t *Tracker) Consumed(buffered int) *Checkpoint {
+	t.trim(buffered)
+	return t.consumed
+}
+
+// trim drops the checkpoints of the logs consumed, i.e. all but the last
+// buffered ones.
+func (t *Tracker) trim(buffered int) {
+	if n := len(t.pending) - buffered; n > 0 {
+		t.consumed = t.pending[n-1]
+		t.pending = t.pending[n:]
+	}
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package checkpoint
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "checkpoint_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	_, err = Load(path)
+	assert.True(t, os.IsNotExist(err))
+
+	expected := &Checkpoint{
+		Inode:     12345,
+		Offset:    678,
+		Timestamp: time.Date(2018, time.January, 2, 3, 4, 5, 0, time.UTC),
+	}
+	assert.NoError(t, Save(path, expected))
+	got, err := Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	// Overwrite the checkpoint.
+	expected.Offset = 910
+	assert.NoError(t, Save(path, expected))
+	got, err = Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	// Save a journal cursor.
+	expected = &Checkpoint{
+		Cursor:    "s=739ad463348b4ceca5a9e69c95a3c93f;i=4ece7;b=6c7c6013a8c24cb99c8f75cc0f3a06a7",
+		Timestamp: time.Date(2018, time.January, 2, 3, 4, 5, 0, time.UTC),
+	}
+	assert.NoError(t, Save(path, expected))
+	got, err = Load(path)
+	assert.NoError(t, err)
+	assert.Equal(t, expected, got)
+
+	// No temporary file should be left.
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	assert.NoError(t, ioutil.WriteFile(path, []byte("corrupted"), 0644))
+	_, err = Load(path)
+	assert.Error(t, err)
+}
+
+func TestTracker(t *testing.T) {
+	start := &Checkpoint{Offset: 0}
+	tracker := NewTracker(start)
+	assert.Equal(t, start, tracker.Consumed(0))
+
+	// Two logs are sent, and none is consumed.
+	tracker.Sent(&Checkpoint{Offset: 10}, 1)
+	tracker.Sent(&Checkpoint{Offset: 20}, 2)
+	assert.Equal(t, start, tracker.Consumed(2))
+	// A log skipped is consumed with the log sent before it.
+	tracker.Skipped(&Checkpoint{Offset: 30}, 2)
+	assert.Equal(t, &Checkpoint{Offset: 10}, tracker.Consumed(1))
+	assert.Equal(t, &Checkpoint{Offset: 30}, tracker.Consumed(0))
+	// A log skipped with all logs consumed is consumed right away.
+	tracker.Skipped(&Checkpoint{Offset: 40}, 0)
+	assert.Equal(t, &Checkpoint{Offset: 40}, tracker.Consumed(0))
+
+	assert.Nil(t, NewTracker(nil).Consumed(0))
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package containerlog implements the log watcher of the container logs
+// written by the container runtimes, in the CRI or docker json-file format.
+package containerlog
+
+import (
+	"fmt"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/filelog"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+)
+
+// formatKey is the key of the container log format in the plugin configuration.
+const formatKey = "format"
+
+// NewContainerLogWatcherOrDie creates a new container log watcher. The
+// container log files are watched by the filelog watcher, so the log path
+// can be a glob pattern, e.g. "/var/log/containers/*.log". The function
+// panics when encounters an error.
+func NewContainerLogWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
+	if err := validatePluginConfig(cfg.PluginConfig); err != nil {
+		glog.Fatalf("Failed to validate plugin configuration %+v: %v", cfg.PluginConfig, err)
+	}
+	format := cfg.PluginConfig[formatKey]
+	if format == "" {
+		format = formatAuto
+	}
+	return filelog.NewWatcherOrDie(cfg, func(path string) filelog.Translator {
+		return newTranslator(format, path)
+	})
+}
+
+// Make sure NewContainerLogWatcherOrDie is types.WatcherCreateFunc.
+var _ types.WatcherCreateFunc = NewContainerLogWatcherOrDie
+
+// validatePluginConfig validates whether the plugin configuration.
+func validatePluginConfig(cfg map[string]string) error {
+	switch format := cfg[formatKey]; format {
+	case "", formatAuto, formatCRI, formatDocker:
+	default:
+		return fmt.Errorf("unsupported container log format %q", format)
+	}
+	return nil
+}
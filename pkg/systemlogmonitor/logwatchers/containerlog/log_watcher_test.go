@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerlog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/filelog"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kube-proxy-abcde_kube-system_kube-proxy-"+containerID+".log")
+	timestamp := time.Now().UTC().Format(time.RFC3339Nano)
+	log := timestamp + " stderr P Failed to list \n" + timestamp + " stderr F *v1.Endpoints\n"
+	assert.NoError(t, ioutil.WriteFile(path, []byte(log), 0644))
+
+	w := NewContainerLogWatcherOrDie(types.WatcherConfig{
+		Plugin:   "containerlog",
+		LogPath:  filepath.Join(dir, "*.log"),
+		Lookback: "1h",
+	})
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+	select {
+	case got := <-logCh:
+		assert.Equal(t, "Failed to list *v1.Endpoints", got.Message)
+		assert.Equal(t, map[string]string{
+			PodField:          "kube-proxy-abcde",
+			NamespaceField:    "kube-system",
+			ContainerField:    "kube-proxy",
+			StreamField:       "stderr",
+			filelog.FileField: path,
+		}, got.Fields)
+	case <-time.After(30 * time.Second):
+		t.Errorf("timeout waiting for log")
+	}
+}
+
+func TestValidatePluginConfig(t *testing.T) {
+	for desc, test := range map[string]struct {
+		format string
+		isErr  bool
+	}{
+		"default format":     {format: ""},
+		"cri format":         {format: formatCRI},
+		"docker format":      {format: formatDocker},
+		"auto format":        {format: formatAuto},
+		"unsupported format": {format: "syslog", isErr: true},
+	} {
+		err := validatePluginConfig(map[string]string{formatKey: test.format})
+		assert.Equal(t, test.isErr, err != nil, desc)
+	}
+}
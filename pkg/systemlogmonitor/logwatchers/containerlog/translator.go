@@ -0,0 +1,205 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// The structured fields of the container logs. The log content is the message
+// of the log.
+const (
+	// PodField is the name of the pod.
+	PodField = "pod"
+	// NamespaceField is the namespace of the pod.
+	NamespaceField = "namespace"
+	// ContainerField is the name of the container.
+	ContainerField = "container"
+	// StreamField is the stream of the log, i.e. stdout or stderr.
+	StreamField = "stream"
+)
+
+// The supported container log formats.
+const (
+	// formatAuto detects the format of each line.
+	formatAuto = "auto"
+	// formatCRI is the CRI log format, e.g.
+	// "2016-10-06T00:17:09.669794202Z stdout F log content".
+	formatCRI = "cri"
+	// formatDocker is the docker json-file log format, e.g.
+	// {"log":"log content\n","stream":"stdout","time":"2016-10-06T00:17:09.669794202Z"}
+	formatDocker = "docker"
+)
+
+// The tags of the CRI log lines.
+const (
+	// tagPartial is the tag of a partial line, which is continued by the next
+	// line of the same stream.
+	tagPartial = "P"
+	// tagFull is the tag of a full line, or the last part of a partial line.
+	tagFull = "F"
+)
+
+// maxPartialSize is the max size of a log reassembled from partial lines. The
+// reassembled log is reported once it exceeds the size even if it's not
+// complete, so that a stream never ending the line can't exhaust the memory.
+const maxPartialSize = 1024 * 1024
+
+var (
+	// containersPathRegexp matches the log path under /var/log/containers, e.g.
+	// "<pod>_<namespace>_<container>-<container id>.log".
+	containersPathRegexp = regexp.MustCompile(`(?:^|/)([^/_]+)_([^/_]+)_([^/]+)-[0-9a-f]{64}\.log$`)
+	// podsPathRegexp matches the log path under /var/log/pods, e.g.
+	// "<namespace>_<pod>_<pod uid>/<container>/<restart count>.log".
+	podsPathRegexp = regexp.MustCompile(`(?:^|/)([^/_]+)_([^/_]+)_[^/_]+/([^/]+)/\d+\.log$`)
+)
+
+// translator translates the container log lines of a log file into internal
+// log type. It reassembles the partial lines, so it should not be shared by
+// different log files.
+type translator struct {
+	format string
+	// fields are the pod, namespace and container parsed from the log path.
+	fields map[string]string
+	// partials are the partial logs waiting for the rest of the line, keyed
+	// by stream.
+	partials map[string]*logtypes.Log
+}
+
+func newTranslator(format, path string) *translator {
+	return &translator{
+		format:   format,
+		fields:   parsePath(path),
+		partials: map[string]*logtypes.Log{},
+	}
+}
+
+// parsePath parses the pod, namespace and container from the log path. It
+// returns empty fields if the log path is in neither /var/log/containers nor
+// /var/log/pods layout.
+func parsePath(path string) map[string]string {
+	if m := containersPathRegexp.FindStringSubmatch(path); m != nil {
+		return map[string]string{PodField: m[1], NamespaceField: m[2], ContainerField: m[3]}
+	}
+	if m := podsPathRegexp.FindStringSubmatch(path); m != nil {
+		return map[string]string{NamespaceField: m[1], PodField: m[2], ContainerField: m[3]}
+	}
+	return map[string]string{}
+}
+
+// Translate translates the container log line into internal type. It returns
+// nil without error for a partial line.
+func (t *translator) Translate(line string) (*logtypes.Log, error) {
+	format := t.format
+	if format == formatAuto {
+		format = detectFormat(line)
+	}
+	var (
+		timestamp       time.Time
+		stream, message string
+		partial         bool
+		err             error
+	)
+	if format == formatDocker {
+		timestamp, stream, message, partial, err = parseDocker(line)
+	} else {
+		timestamp, stream, message, partial, err = parseCRI(line)
+	}
+	if err != nil {
+		return nil, err
+	}
+	log, ok := t.partials[stream]
+	if ok {
+		log.Message += message
+	} else {
+		log = &logtypes.Log{
+			Timestamp: timestamp,
+			Message:   message,
+		}
+	}
+	if partial && len(log.Message) < maxPartialSize {
+		t.partials[stream] = log
+		return nil, nil
+	}
+	delete(t.partials, stream)
+	log.Fields = map[string]string{StreamField: stream}
+	for name, value := range t.fields {
+		log.Fields[name] = value
+	}
+	return log, nil
+}
+
+// detectFormat detects the container log format of the line. Docker json-file
+// logs are json objects, while CRI logs start with the timestamp.
+func detectFormat(line string) string {
+	if strings.HasPrefix(line, "{") {
+		return formatDocker
+	}
+	return formatCRI
+}
+
+// parseCRI parses the CRI log line.
+func parseCRI(line string) (time.Time, string, string, bool, error) {
+	parts := strings.SplitN(line, " ", 4)
+	if len(parts) < 3 {
+		return time.Time{}, "", "", false, fmt.Errorf("invalid CRI log line %q", line)
+	}
+	timestamp, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return time.Time{}, "", "", false, fmt.Errorf("failed to parse timestamp %q: %v", parts[0], err)
+	}
+	var message string
+	if len(parts) == 4 {
+		message = parts[3]
+	}
+	// The tag may have multiple ":" separated tags, and the first one is the
+	// partial tag.
+	switch tag := strings.Split(parts[2], ":")[0]; tag {
+	case tagPartial:
+		return timestamp, parts[1], message, true, nil
+	case tagFull:
+		return timestamp, parts[1], message, false, nil
+	default:
+		return time.Time{}, "", "", false, fmt.Errorf("unknown tag %q in CRI log line %q", tag, line)
+	}
+}
+
+// dockerLog is a line of the docker json-file log.
+type dockerLog struct {
+	Log    string    `json:"log"`
+	Stream string    `json:"stream"`
+	Time   time.Time `json:"time"`
+}
+
+// parseDocker parses the docker json-file log line. A log not ending with a
+// newline is a partial line.
+func parseDocker(line string) (time.Time, string, string, bool, error) {
+	var l dockerLog
+	if err := json.Unmarshal([]byte(line), &l); err != nil {
+		return time.Time{}, "", "", false, fmt.Errorf("failed to unmarshal line %q: %v", line, err)
+	}
+	if !strings.HasSuffix(l.Log, "\n") {
+		return l.Time, l.Stream, l.Log, true, nil
+	}
+	return l.Time, l.Stream, strings.TrimSuffix(l.Log, "\n"), false, nil
+}
@@ -0,0 +1,175 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package containerlog
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+const containerID = "8ff5c8e5ee0b8ea3b0ac7c39e0b8b9a9d1f5b5c8d9e3f2a1b0c9d8e7f6a5b4c3"
+
+func TestParsePath(t *testing.T) {
+	for desc, test := range map[string]struct {
+		path     string
+		expected map[string]string
+	}{
+		"containers path": {
+			path: "/var/log/containers/kube-proxy-abcde_kube-system_kube-proxy-" + containerID + ".log",
+			expected: map[string]string{
+				PodField:       "kube-proxy-abcde",
+				NamespaceField: "kube-system",
+				ContainerField: "kube-proxy",
+			},
+		},
+		"pods path": {
+			path: "/var/log/pods/kube-system_calico-node-xyz_0f7d4c3e-1234-11e8-9c3a-42010a800002/calico-node/1.log",
+			expected: map[string]string{
+				PodField:       "calico-node-xyz",
+				NamespaceField: "kube-system",
+				ContainerField: "calico-node",
+			},
+		},
+		"unknown path": {
+			path:     "/var/log/app.log",
+			expected: map[string]string{},
+		},
+	} {
+		assert.Equal(t, test.expected, parsePath(test.path), desc)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	timestamp := time.Date(2018, time.January, 2, 3, 4, 5, 123456789, time.UTC)
+	path := "/var/log/containers/kube-proxy-abcde_kube-system_kube-proxy-" + containerID + ".log"
+	logFields := func(stream string) map[string]string {
+		return map[string]string{
+			PodField:       "kube-proxy-abcde",
+			NamespaceField: "kube-system",
+			ContainerField: "kube-proxy",
+			StreamField:    stream,
+		}
+	}
+	for desc, test := range map[string]struct {
+		format   string
+		lines    []string
+		expected []*logtypes.Log
+		isErr    bool
+	}{
+		"cri full line": {
+			format: formatCRI,
+			lines:  []string{"2018-01-02T03:04:05.123456789Z stderr F Failed to list *v1.Endpoints"},
+			expected: []*logtypes.Log{
+				{Timestamp: timestamp, Message: "Failed to list *v1.Endpoints", Fields: logFields("stderr")},
+			},
+		},
+		"cri partial lines": {
+			format: formatCRI,
+			lines: []string{
+				"2018-01-02T03:04:05.123456789Z stdout P part 1, ",
+				"2018-01-02T03:04:06Z stderr F interleaved",
+				"2018-01-02T03:04:07Z stdout P part 2, ",
+				"2018-01-02T03:04:08Z stdout F part 3",
+			},
+			expected: []*logtypes.Log{
+				nil,
+				{Timestamp: timestamp.Truncate(time.Second).Add(time.Second), Message: "interleaved", Fields: logFields("stderr")},
+				nil,
+				{Timestamp: timestamp, Message: "part 1, part 2, part 3", Fields: logFields("stdout")},
+			},
+		},
+		"cri empty line": {
+			format: formatCRI,
+			lines:  []string{"2018-01-02T03:04:05.123456789Z stdout F"},
+			expected: []*logtypes.Log{
+				{Timestamp: timestamp, Message: "", Fields: logFields("stdout")},
+			},
+		},
+		"cri unknown tag": {
+			format: formatCRI,
+			lines:  []string{"2018-01-02T03:04:05.123456789Z stdout X content"},
+			isErr:  true,
+		},
+		"cri invalid timestamp": {
+			format: formatCRI,
+			lines:  []string{"Jan 2 03:04:05 stdout F content"},
+			isErr:  true,
+		},
+		"docker full line": {
+			format: formatDocker,
+			lines:  []string{`{"log":"Failed to list *v1.Endpoints\n","stream":"stderr","time":"2018-01-02T03:04:05.123456789Z"}`},
+			expected: []*logtypes.Log{
+				{Timestamp: timestamp, Message: "Failed to list *v1.Endpoints", Fields: logFields("stderr")},
+			},
+		},
+		"docker partial lines": {
+			format: formatDocker,
+			lines: []string{
+				`{"log":"part 1, ","stream":"stdout","time":"2018-01-02T03:04:05.123456789Z"}`,
+				`{"log":"part 2\n","stream":"stdout","time":"2018-01-02T03:04:06Z"}`,
+			},
+			expected: []*logtypes.Log{
+				nil,
+				{Timestamp: timestamp, Message: "part 1, part 2", Fields: logFields("stdout")},
+			},
+		},
+		"docker invalid json": {
+			format: formatDocker,
+			lines:  []string{`{"log":`},
+			isErr:  true,
+		},
+		"auto detect formats": {
+			format: formatAuto,
+			lines: []string{
+				"2018-01-02T03:04:05.123456789Z stdout F cri",
+				`{"log":"docker\n","stream":"stdout","time":"2018-01-02T03:04:05.123456789Z"}`,
+			},
+			expected: []*logtypes.Log{
+				{Timestamp: timestamp, Message: "cri", Fields: logFields("stdout")},
+				{Timestamp: timestamp, Message: "docker", Fields: logFields("stdout")},
+			},
+		},
+	} {
+		trans := newTranslator(test.format, path)
+		for i, line := range test.lines {
+			log, err := trans.Translate(line)
+			if test.isErr {
+				assert.Error(t, err, desc)
+				continue
+			}
+			assert.NoError(t, err, desc)
+			assert.Equal(t, test.expected[i], log, desc)
+		}
+	}
+}
+
+func TestMaxPartialSize(t *testing.T) {
+	trans := newTranslator(formatCRI, "/var/log/app.log")
+	part := strings.Repeat("x", maxPartialSize/2)
+	log, err := trans.Translate("2018-01-02T03:04:05Z stdout P " + part)
+	assert.NoError(t, err)
+	assert.Nil(t, log)
+	// The log is reported once it exceeds the max size.
+	log, err = trans.Translate("2018-01-02T03:04:05Z stdout P " + part)
+	assert.NoError(t, err)
+	assert.Equal(t, part+part, log.Message)
+}
@@ -0,0 +1,103 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"bufio"
+	"bytes"
+	"strings"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/tail"
+)
+
+// logFile is a log file watched by the filelog watcher.
+type logFile struct {
+	path       string
+	tailer     *tail.Tail
+	reader     *bufio.Reader
+	translator Translator
+	// buffer is the incomplete line read.
+	buffer bytes.Buffer
+	// bufferGeneration is the generation of the tailer the incomplete line is
+	// read in.
+	bufferGeneration int
+	// next is the complete line read right after the incomplete line of the
+	// rotated or truncated file, which is returned by the next readLine.
+	next string
+}
+
+func newLogFile(path string, tailer *tail.Tail, translator Translator) *logFile {
+	return &logFile{
+		path:       path,
+		tailer:     tailer,
+		reader:     bufio.NewReader(tailer),
+		translator: translator,
+	}
+}
+
+// readLine reads a complete line from the log file. It returns io.EOF when
+// there is no complete line for now, and the incomplete line is kept until
+// the rest of the line is read. The incomplete last line of the file before
+// rotation or truncation never completes, so it's returned as a line once the
+// new content is read instead of being joined with the new content.
+func (f *logFile) readLine() (string, error) {
+	if f.next != "" {
+		line := f.next
+		f.next = ""
+		return line, nil
+	}
+	line, err := f.reader.ReadString('\n')
+	generation := f.tailer.Generation()
+	if f.buffer.Len() > 0 && line != "" && generation != f.bufferGeneration {
+		glog.V(2).Infof("Log file %q is rotated or truncated after incomplete line %q", f.path, f.buffer.String())
+		last := f.buffer.String()
+		f.buffer.Reset()
+		if err == nil {
+			f.next = line
+		} else {
+			f.buffer.WriteString(line)
+			f.bufferGeneration = generation
+		}
+		return last, nil
+	}
+	if f.buffer.Len() == 0 {
+		f.bufferGeneration = generation
+	}
+	f.buffer.WriteString(line)
+	if err != nil {
+		return "", err
+	}
+	line = f.buffer.String()
+	f.buffer.Reset()
+	return line, nil
+}
+
+// position returns the inode and the offset of the next line to read in the
+// log file. The offset is negative if the incomplete line started in the
+// rotated file.
+func (f *logFile) position() (uint64, int64) {
+	ino, offset := f.tailer.Position()
+	return ino, offset - int64(f.reader.Buffered()+f.buffer.Len()+len(f.next))
+}
+
+// isGlob checks whether the log path is a glob pattern matching multiple log
+// files.
+func isGlob(path string) bool {
+	return strings.ContainsAny(path, `*?[`)
+}
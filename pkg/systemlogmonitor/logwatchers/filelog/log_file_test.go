@@ -0,0 +1,76 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package filelog
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/tail"
+)
+
+func TestReadLineAfterRotation(t *testing.T) {
+	for desc, rotate := range map[string]func(path string){
+		"rename and create": func(path string) {
+			require.NoError(t, os.Rename(path, path+tail.RotatedSuffix))
+			require.NoError(t, ioutil.WriteFile(path, []byte("line 3\nline 4\n"), 0644))
+		},
+		"copy and truncate": func(path string) {
+			require.NoError(t, ioutil.WriteFile(path, []byte("line 3\nline 4\n"), 0644))
+		},
+	} {
+		dir, err := ioutil.TempDir("", "log_file_test")
+		require.NoError(t, err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "kern.log")
+		require.NoError(t, ioutil.WriteFile(path, []byte("line 1 is longer\nline 2"), 0644))
+		r, err := tail.NewTail(path, false)
+		require.NoError(t, err)
+		defer r.Close()
+		f := newLogFile(path, r, nil)
+
+		line, err := f.readLine()
+		assert.NoError(t, err, desc)
+		assert.Equal(t, "line 1 is longer\n", line, desc)
+		// The last line is incomplete.
+		_, err = f.readLine()
+		assert.Equal(t, io.EOF, err, desc)
+
+		rotate(path)
+		// The incomplete line is not joined with the first line of the new
+		// content.
+		var lines []string
+		for i := 0; i < 10 && len(lines) < 3; i++ {
+			if line, err := f.readLine(); err == nil {
+				lines = append(lines, line)
+			}
+			if len(lines) == 1 {
+				// The next line to read is the head of the new content.
+				ino, offset := f.position()
+				assert.NotZero(t, ino, desc)
+				assert.Zero(t, offset, desc)
+			}
+		}
+		assert.Equal(t, []string{"line 2", "line 3\n", "line 4\n"}, lines, desc)
+	}
+}
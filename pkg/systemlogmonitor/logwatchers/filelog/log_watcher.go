@@ -17,38 +17,73 @@ limitations under the License.
 package filelog
 
 import (
-	"bufio"
-	"bytes"
 	"fmt"
 	"io"
-	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 
 	utilclock "code.cloudfoundry.org/clock"
 	"github.com/golang/glog"
-	"github.com/google/cadvisor/utils/tail"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/checkpoint"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/tail"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util"
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
+// FileField is the structured field of the log carrying the path of the log
+// file the log is read from.
+const FileField = "FILE"
+
+// Translator translates the lines of a log file into logs.
+type Translator interface {
+	// Translate translates a line without the trailing newline. It returns
+	// nil without error if the line doesn't complete a log yet, e.g. a partial
+	// line of a container log.
+	Translate(line string) (*logtypes.Log, error)
+}
+
+// NewTranslatorFunc creates the translator of a log file. Translators keeping
+// state across lines should not be shared by different log files.
+type NewTranslatorFunc func(path string) Translator
+
 type filelogWatcher struct {
-	cfg        types.WatcherConfig
-	reader     *bufio.Reader
-	closer     io.Closer
-	translator *translator
-	logCh      chan *logtypes.Log
-	startTime  time.Time
-	tomb       *tomb.Tomb
-	clock      utilclock.Clock
+	cfg types.WatcherConfig
+	// files are the watched log files keyed by path.
+	files         map[string]*logFile
+	newTranslator NewTranslatorFunc
+	logCh         chan *logtypes.Log
+	startTime     time.Time
+	// lastTimestamp is the timestamp of the last log read, which is saved in
+	// the checkpoint.
+	lastTimestamp time.Time
+	// tracker tracks the checkpoints of the logs sent, so that only the logs
+	// consumed are covered by the saved checkpoint. It's nil without
+	// checkpoint.
+	tracker *checkpoint.Tracker
+	// lookbackRotated indicates whether to look back the just rotated log
+	// file on start.
+	lookbackRotated bool
+	tomb            *tomb.Tomb
+	clock           utilclock.Clock
 }
 
 // NewSyslogWatcherOrDie creates a new log watcher. The function panics
 // when encounters an error.
 func NewSyslogWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
+	translator := newTranslatorOrDie(cfg.PluginConfig)
+	return NewWatcherOrDie(cfg, func(string) Translator { return translator })
+}
+
+// NewWatcherOrDie creates a new log watcher of the log files, translating the
+// lines of each log file with the translator created for it. It's used by the
+// log watchers of the file based logs in other formats. The function panics
+// when encounters an error.
+func NewWatcherOrDie(cfg types.WatcherConfig, newTranslator NewTranslatorFunc) types.LogWatcher {
 	uptime, err := util.GetUptimeDuration()
 	if err != nil {
 		glog.Fatalf("failed to get uptime: %v", err)
@@ -57,12 +92,20 @@ func NewSyslogWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
 	if err != nil {
 		glog.Fatalf("failed to get start time: %v", err)
 	}
+	var lookbackRotated bool
+	if value, ok := cfg.PluginConfig[lookbackRotatedKey]; ok {
+		if lookbackRotated, err = strconv.ParseBool(value); err != nil {
+			glog.Fatalf("failed to parse %s %q: %v", lookbackRotatedKey, value, err)
+		}
+	}
 
 	return &filelogWatcher{
-		cfg:        cfg,
-		translator: newTranslatorOrDie(cfg.PluginConfig),
-		startTime:  startTime,
-		tomb:       tomb.NewTomb(),
+		cfg:             cfg,
+		newTranslator:   newTranslator,
+		startTime:       startTime,
+		files:           map[string]*logFile{},
+		lookbackRotated: lookbackRotated,
+		tomb:            tomb.NewTomb(),
 		// A capacity 1000 buffer should be enough
 		logCh: make(chan *logtypes.Log, 1000),
 		clock: utilclock.NewClock(),
@@ -74,12 +117,22 @@ var _ types.WatcherCreateFunc = NewSyslogWatcherOrDie
 
 // Watch starts the filelog watcher.
 func (s *filelogWatcher) Watch() (<-chan *logtypes.Log, error) {
-	r, err := getLogReader(s.cfg.LogPath)
-	if err != nil {
-		return nil, err
+	if isGlob(s.cfg.LogPath) {
+		if _, err := filepath.Match(s.cfg.LogPath, ""); err != nil {
+			return nil, fmt.Errorf("invalid log path pattern %q: %v", s.cfg.LogPath, err)
+		}
+		if s.cfg.Checkpoint != "" {
+			return nil, fmt.Errorf("checkpoint is not supported with log path pattern %q", s.cfg.LogPath)
+		}
+		s.updateFiles()
+	} else {
+		r, err := s.getLogReader()
+		if err != nil {
+			return nil, err
+		}
+		s.files[s.cfg.LogPath] = newLogFile(s.cfg.LogPath, r, s.newTranslator(s.cfg.LogPath))
 	}
-	s.reader = bufio.NewReader(r)
-	s.closer = r
+	s.lastTimestamp = s.startTime
 	glog.Info("Start watching filelog")
 	go s.watchLoop()
 	return s.logCh, nil
@@ -90,6 +143,17 @@ func (s *filelogWatcher) Stop() {
 	s.tomb.Stop()
 }
 
+// lookbackRotatedKey is the key of whether to look back the just rotated log
+// file, e.g. "kern.log.1", on start in the plugin configuration.
+const lookbackRotatedKey = "lookbackRotated"
+
+// checkpointInterval is the interval to save the checkpoint.
+const checkpointInterval = 10 * time.Second
+
+// globInterval is the interval to match the log path pattern again to pick up
+// the new log files and drop the deleted ones.
+const globInterval = 5 * time.Second
+
 // watchPollInterval is the interval filelog log watcher will
 // poll for pod change after reading to the end.
 const watchPollInterval = 500 * time.Millisecond
@@ -97,11 +161,15 @@ const watchPollInterval = 500 * time.Millisecond
 // watchLoop is the main watch loop of filelog watcher.
 func (s *filelogWatcher) watchLoop() {
 	defer func() {
-		s.closer.Close()
+		s.saveCheckpoint()
+		for _, f := range s.files {
+			f.tailer.Close()
+		}
 		close(s.logCh)
 		s.tomb.Done()
 	}()
-	var buffer bytes.Buffer
+	lastCheckpoint := s.clock.Now()
+	lastGlob := s.clock.Now()
 	for {
 		select {
 		case <-s.tomb.Stopping():
@@ -109,52 +177,164 @@ func (s *filelogWatcher) watchLoop() {
 			return
 		default:
 		}
+		if s.clock.Since(lastCheckpoint) >= checkpointInterval {
+			s.saveCheckpoint()
+			lastCheckpoint = s.clock.Now()
+		}
+		if isGlob(s.cfg.LogPath) && s.clock.Since(lastGlob) >= globInterval {
+			s.updateFiles()
+			lastGlob = s.clock.Now()
+		}
 
-		line, err := s.reader.ReadString('\n')
-		if err != nil && err != io.EOF {
-			glog.Errorf("Exiting filelog watch with error: %v", err)
-			return
+		// Read a line from each log file in turn, so that a busy log file
+		// doesn't starve the others.
+		eof := true
+		for _, f := range s.files {
+			line, err := f.readLine()
+			if err == io.EOF {
+				continue
+			}
+			if err != nil {
+				glog.Errorf("Exiting filelog watch with error: %v", err)
+				return
+			}
+			eof = false
+			s.processLine(f, line)
 		}
-		buffer.WriteString(line)
-		if err == io.EOF {
+		if eof {
 			time.Sleep(watchPollInterval)
+		}
+	}
+}
+
+// processLine translates the line read from the log file, and sends the log
+// if it's not before the start time.
+func (s *filelogWatcher) processLine(f *logFile, line string) {
+	log, err := f.translator.Translate(strings.TrimSuffix(line, "\n"))
+	if err != nil {
+		glog.Warningf("Unable to parse line: %q, %v", line, err)
+		s.trackCheckpoint(f, false)
+		return
+	}
+	if log == nil {
+		return
+	}
+	if log.Fields == nil {
+		log.Fields = map[string]string{}
+	}
+	log.Fields[FileField] = f.path
+	s.lastTimestamp = log.Timestamp
+	// Discard messages before start time.
+	if log.Timestamp.Before(s.startTime) {
+		glog.V(5).Infof("Throwing away msg %q before start time: %v < %v", log.Message, log.Timestamp, s.startTime)
+		s.trackCheckpoint(f, false)
+		return
+	}
+	s.logCh <- log
+	s.trackCheckpoint(f, true)
+}
+
+// trackCheckpoint tracks the position after the log just processed, which is
+// either sent to the log channel or skipped.
+func (s *filelogWatcher) trackCheckpoint(f *logFile, sent bool) {
+	if s.tracker == nil || f.path != s.cfg.LogPath {
+		return
+	}
+	ino, offset := f.position()
+	if ino == 0 || offset < 0 {
+		// The incomplete line started in the rotated file. Keep tracking from
+		// the last position.
+		return
+	}
+	c := &checkpoint.Checkpoint{
+		Inode:     ino,
+		Offset:    offset,
+		Timestamp: s.lastTimestamp,
+	}
+	if sent {
+		s.tracker.Sent(c, len(s.logCh))
+	} else {
+		s.tracker.Skipped(c, len(s.logCh))
+	}
+}
+
+// updateFiles matches the log path pattern, starts watching the new log files,
+// and stops watching the deleted ones after reading the rest of them.
+func (s *filelogWatcher) updateFiles() {
+	paths, err := filepath.Glob(s.cfg.LogPath)
+	if err != nil {
+		glog.Errorf("Failed to match log path pattern %q: %v", s.cfg.LogPath, err)
+		return
+	}
+	matched := map[string]bool{}
+	for _, path := range paths {
+		matched[path] = true
+		if _, ok := s.files[path]; ok {
 			continue
 		}
-		line = buffer.String()
-		buffer.Reset()
-		log, err := s.translator.translate(strings.TrimSuffix(line, "\n"))
+		r, err := tail.NewTail(path, s.lookbackRotated)
 		if err != nil {
-			glog.Warningf("Unable to parse line: %q, %v", line, err)
+			glog.Errorf("Failed to tail log file %q: %v", path, err)
 			continue
 		}
-		// Discard messages before start time.
-		if log.Timestamp.Before(s.startTime) {
-			glog.V(5).Infof("Throwing away msg %q before start time: %v < %v", log.Message, log.Timestamp, s.startTime)
+		glog.Infof("Start watching log file %q", path)
+		s.files[path] = newLogFile(path, r, s.newTranslator(path))
+	}
+	for path, f := range s.files {
+		if matched[path] {
 			continue
 		}
-		s.logCh <- log
+		for {
+			line, err := f.readLine()
+			if err != nil {
+				break
+			}
+			s.processLine(f, line)
+		}
+		glog.Infof("Stop watching deleted log file %q", path)
+		f.tailer.Close()
+		delete(s.files, path)
 	}
 }
 
-// getLogReader returns log reader for filelog log. Note that getLogReader doesn't look back
-// to the rolled out logs.
-func getLogReader(path string) (io.ReadCloser, error) {
-	if path == "" {
-		return nil, fmt.Errorf("unexpected empty log path")
-	}
-	// To handle log rotation, tail will not report error immediately if
-	// the file doesn't exist. So we check file existence first.
-	// This could go wrong during mid-rotation. It should recover after
-	// several restart when the log file is created again. The chance
-	// is slim but we should still fix this in the future.
-	// TODO(random-liu): Handle log missing during rotation.
-	_, err := os.Stat(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to stat the file %q: %v", path, err)
+// getLogReader returns the log reader resuming from the checkpoint if there is
+// a valid one, or looking back from the start time otherwise.
+func (s *filelogWatcher) getLogReader() (*tail.Tail, error) {
+	if s.cfg.Checkpoint == "" {
+		return tail.NewTail(s.cfg.LogPath, s.lookbackRotated)
 	}
-	tail, err := tail.NewTail(path)
-	if err != nil {
-		return nil, fmt.Errorf("failed to tail the file %q: %v", path, err)
+	s.tracker = checkpoint.NewTracker(nil)
+	c, err := checkpoint.Load(s.cfg.Checkpoint)
+	if err == nil {
+		if c.Timestamp.After(s.clock.Now()) {
+			err = fmt.Errorf("checkpoint timestamp %v is in the future", c.Timestamp)
+		} else {
+			var r *tail.Tail
+			if r, err = tail.NewTailFrom(s.cfg.LogPath, c.Inode, c.Offset); err == nil {
+				glog.Infof("Resume watching %q from checkpoint %+v", s.cfg.LogPath, *c)
+				s.startTime = c.Timestamp
+				s.tracker = checkpoint.NewTracker(c)
+				return r, nil
+			}
+		}
+	}
+	glog.Warningf("Failed to resume from checkpoint %q, look back from %v instead: %v", s.cfg.Checkpoint, s.startTime, err)
+	return tail.NewTail(s.cfg.LogPath, s.lookbackRotated)
+}
+
+// saveCheckpoint saves the position after the last log consumed from the log
+// channel in the checkpoint. The logs still in the log channel are read again
+// after restart.
+func (s *filelogWatcher) saveCheckpoint() {
+	if s.tracker == nil {
+		return
+	}
+	c := s.tracker.Consumed(len(s.logCh))
+	if c == nil {
+		// No log has been consumed yet. Keep the last checkpoint.
+		return
+	}
+	if err := checkpoint.Save(s.cfg.Checkpoint, c); err != nil {
+		glog.Errorf("Failed to save checkpoint: %v", err)
 	}
-	return tail, nil
 }
@@ -19,10 +19,12 @@ package filelog
 import (
 	"io/ioutil"
 	"os"
+	"path/filepath"
 	"runtime"
 	"testing"
 	"time"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/checkpoint"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util"
@@ -163,6 +165,8 @@ Jan  2 03:04:05 kernel: [2.000000] 3
 		assert.NoError(t, err)
 		defer w.Stop()
 		for _, expected := range test.logs {
+			// The logs are tagged with the log file.
+			expected.Fields = map[string]string{FileField: f.Name()}
 			select {
 			case got := <-logCh:
 				assert.Equal(t, &expected, got)
@@ -186,10 +190,193 @@ func TestGoroutineLeak(t *testing.T) {
 	w := NewSyslogWatcherOrDie(types.WatcherConfig{
 		Plugin:       "filelog",
 		PluginConfig: getTestPluginConfig(),
-		LogPath:      "/not/exist/path",
+		LogPath:      "",
 		Lookback:     "10m",
 	})
 	_, err := w.Watch()
 	assert.Error(t, err)
 	assert.Equal(t, orignal, runtime.NumGoroutine())
 }
+
+func TestWatchMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kern.log")
+
+	w := NewSyslogWatcherOrDie(types.WatcherConfig{
+		Plugin:       "filelog",
+		PluginConfig: getTestPluginConfig(),
+		LogPath:      path,
+		Lookback:     "0",
+	})
+	// Watch should wait for the missing file instead of failing.
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+	now := time.Now().Add(time.Hour)
+	assert.NoError(t, ioutil.WriteFile(path, []byte(now.Format("Jan _2 15:04:05")+" kernel: [0.000000] 1\n"), 0644))
+	select {
+	case got := <-logCh:
+		assert.Equal(t, "1", got.Message)
+	case <-time.After(30 * time.Second):
+		t.Errorf("timeout waiting for log")
+	}
+}
+
+func TestCheckpoint(t *testing.T) {
+	now := time.Date(time.Now().Year(), time.January, 2, 3, 4, 5, 0, time.Local)
+	fakeClock := fakeclock.NewFakeClock(now.Add(time.Hour))
+	dir, err := ioutil.TempDir("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "kern.log")
+	checkpointPath := filepath.Join(dir, "checkpoint")
+	appendLog := func(log string) {
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		defer f.Close()
+		_, err = f.WriteString(log)
+		assert.NoError(t, err)
+	}
+	// watch starts a watcher looking back from startTime, expects the
+	// messages of the logs, and stops it with the number of logs left
+	// unconsumed in the log channel.
+	watch := func(startTime time.Time, expected []string, unconsumed int) {
+		w := NewSyslogWatcherOrDie(types.WatcherConfig{
+			Plugin:       "filelog",
+			PluginConfig: getTestPluginConfig(),
+			LogPath:      path,
+			Checkpoint:   checkpointPath,
+		})
+		w.(*filelogWatcher).startTime = startTime
+		w.(*filelogWatcher).clock = fakeClock
+		logCh, err := w.Watch()
+		assert.NoError(t, err)
+		for _, message := range expected {
+			select {
+			case got := <-logCh:
+				assert.Equal(t, message, got.Message)
+			case <-time.After(30 * time.Second):
+				t.Errorf("timeout waiting for log %q", message)
+			}
+		}
+		for len(logCh) < unconsumed {
+			time.Sleep(10 * time.Millisecond)
+		}
+		w.Stop()
+		for log := range logCh {
+			if unconsumed--; unconsumed < 0 {
+				t.Errorf("unexpected extra log: %+v", *log)
+			}
+		}
+	}
+
+	appendLog(`Jan  2 03:04:05 kernel: [0.000000] 1
+Jan  2 03:04:06 kernel: [1.000000] 2
+`)
+	// No checkpoint, look back from the start time.
+	watch(now, []string{"1", "2"}, 0)
+	c, err := checkpoint.Load(checkpointPath)
+	assert.NoError(t, err)
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), c.Offset)
+	assert.True(t, now.Add(time.Second).Equal(c.Timestamp))
+
+	// Resume from the checkpoint, even if the logs are before the start time.
+	appendLog("Jan  2 03:04:07 kernel: [2.000000] 3\n")
+	watch(now.Add(time.Hour), []string{"3"}, 0)
+
+	// The logs left in the log channel on stop are not checkpointed, and are
+	// read again after restart.
+	info, err = os.Stat(path)
+	assert.NoError(t, err)
+	appendLog(`Jan  2 03:04:08 kernel: [3.000000] 4
+Jan  2 03:04:09 kernel: [4.000000] 5
+`)
+	watch(now.Add(time.Hour), nil, 2)
+	c, err = checkpoint.Load(checkpointPath)
+	assert.NoError(t, err)
+	assert.Equal(t, info.Size(), c.Offset)
+	assert.True(t, now.Add(2*time.Second).Equal(c.Timestamp))
+	watch(now.Add(time.Hour), []string{"4", "5"}, 0)
+
+	// Fall back to look back with an invalid checkpoint.
+	assert.NoError(t, ioutil.WriteFile(checkpointPath, []byte("invalid"), 0644))
+	watch(now.Add(time.Second), []string{"2", "3", "4", "5"}, 0)
+}
+
+func TestWatchGlob(t *testing.T) {
+	now := time.Date(time.Now().Year(), time.January, 2, 3, 4, 5, 0, time.Local)
+	fakeClock := fakeclock.NewFakeClock(now)
+	dir, err := ioutil.TempDir("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	pathA := filepath.Join(dir, "a", "error.log")
+	pathB := filepath.Join(dir, "b", "error.log")
+	appendLog := func(path, log string) {
+		assert.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		assert.NoError(t, err)
+		defer f.Close()
+		_, err = f.WriteString(log)
+		assert.NoError(t, err)
+	}
+
+	appendLog(pathA, "Jan  2 03:04:05 kernel: [0.000000] 1\n")
+	w := NewSyslogWatcherOrDie(types.WatcherConfig{
+		Plugin:       "filelog",
+		PluginConfig: getTestPluginConfig(),
+		LogPath:      filepath.Join(dir, "*", "error.log"),
+	})
+	w.(*filelogWatcher).startTime = now
+	w.(*filelogWatcher).clock = fakeClock
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	expectLog := func(path, message string) {
+		select {
+		case got := <-logCh:
+			assert.Equal(t, message, got.Message)
+			assert.Equal(t, map[string]string{FileField: path}, got.Fields)
+		case <-time.After(30 * time.Second):
+			t.Errorf("timeout waiting for log %q", message)
+		}
+	}
+	expectLog(pathA, "1")
+
+	// The new log file should be picked up.
+	appendLog(pathB, "Jan  2 03:04:06 kernel: [1.000000] 2\n")
+	fakeClock.Increment(globInterval)
+	expectLog(pathB, "2")
+
+	// The deleted log file should be dropped after reading the rest of it.
+	appendLog(pathA, "Jan  2 03:04:07 kernel: [2.000000] 3\n")
+	assert.NoError(t, os.Remove(pathA))
+	fakeClock.Increment(globInterval)
+	expectLog(pathA, "3")
+	appendLog(pathB, "Jan  2 03:04:08 kernel: [3.000000] 4\n")
+	expectLog(pathB, "4")
+
+	w.Stop()
+	_, ok := w.(*filelogWatcher).files[pathA]
+	assert.False(t, ok)
+}
+
+func TestWatchInvalidGlob(t *testing.T) {
+	for desc, cfg := range map[string]types.WatcherConfig{
+		"invalid pattern": {
+			LogPath: "/var/log/[.log",
+		},
+		"checkpoint with pattern": {
+			LogPath:    "/var/log/*.log",
+			Checkpoint: "/var/lib/checkpoint",
+		},
+	} {
+		cfg.Plugin = "filelog"
+		cfg.PluginConfig = getTestPluginConfig()
+		w := NewSyslogWatcherOrDie(cfg)
+		_, err := w.Watch()
+		assert.Error(t, err, desc)
+	}
+}
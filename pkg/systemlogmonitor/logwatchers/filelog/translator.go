@@ -55,8 +55,8 @@ func newTranslatorOrDie(pluginConfig map[string]string) *translator {
 	}
 }
 
-// translate translates the log line into internal type.
-func (t *translator) translate(line string) (*logtypes.Log, error) {
+// Translate translates the log line into internal type.
+func (t *translator) Translate(line string) (*logtypes.Log, error) {
 	// Parse timestamp.
 	matches := t.timestampRegexp.FindStringSubmatch(line)
 	if len(matches) == 0 {
@@ -79,7 +79,7 @@ func TestTranslate(t *testing.T) {
 	for c, test := range testCases {
 		t.Logf("TestCase #%d: %#v", c+1, test)
 		trans := newTranslatorOrDie(test.config)
-		log, err := trans.translate(test.input)
+		log, err := trans.Translate(test.input)
 		if !test.err {
 			require.NoError(t, err)
 			// Use RFC3339Nano to make it easier for comparison.
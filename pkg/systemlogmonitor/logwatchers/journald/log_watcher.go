@@ -27,6 +27,7 @@ import (
 	"github.com/coreos/go-systemd/sdjournal"
 	"github.com/golang/glog"
 
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/checkpoint"
 	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 	"k8s.io/node-problem-detector/pkg/util"
@@ -43,8 +44,17 @@ type journaldWatcher struct {
 	journal   *sdjournal.Journal
 	cfg       types.WatcherConfig
 	startTime time.Time
-	logCh     chan *logtypes.Log
-	tomb      *tomb.Tomb
+	// sources are the syslog identifiers of the logs to watch.
+	sources []string
+	// matches are the groups of journal field matches of the logs to watch.
+	matches [][]sdjournal.Match
+	// fields are the journal fields exposed in the logs.
+	fields []string
+	// tracker tracks the cursors of the journal entries read, so that only
+	// the entries consumed are covered by the saved checkpoint.
+	tracker *checkpoint.Tracker
+	logCh   chan *logtypes.Log
+	tomb    *tomb.Tomb
 }
 
 // NewJournaldWatcher is the create function of journald watcher.
@@ -57,10 +67,21 @@ func NewJournaldWatcher(cfg types.WatcherConfig) types.LogWatcher {
 	if err != nil {
 		glog.Fatalf("failed to get start time: %v", err)
 	}
+	matches, err := parseMatches(cfg.PluginConfig[configMatchKey])
+	if err != nil {
+		glog.Fatalf("failed to parse journal matches: %v", err)
+	}
+	fields := append([]string{}, logFields...)
+	fields = append(fields, matchFields(matches)...)
+	fields = append(fields, splitList(cfg.PluginConfig[configFieldsKey])...)
 
 	return &journaldWatcher{
 		cfg:       cfg,
 		startTime: startTime,
+		sources:   splitList(cfg.PluginConfig[configSourceKey]),
+		matches:   matches,
+		fields:    fields,
+		tracker:   checkpoint.NewTracker(nil),
 		tomb:      tomb.NewTomb(),
 		// A capacity 1000 buffer should be enough
 		logCh: make(chan *logtypes.Log, 1000),
@@ -72,7 +93,7 @@ var _ types.WatcherCreateFunc = NewJournaldWatcher
 
 // Watch starts the journal watcher.
 func (j *journaldWatcher) Watch() (<-chan *logtypes.Log, error) {
-	journal, err := getJournal(j.cfg, j.startTime)
+	journal, err := j.getJournal()
 	if err != nil {
 		return nil, err
 	}
@@ -90,10 +111,15 @@ func (j *journaldWatcher) Stop() {
 // waitLogTimeout is the timeout waiting for new log.
 const waitLogTimeout = 5 * time.Second
 
+// checkpointInterval is the interval to save the checkpoint.
+const checkpointInterval = 10 * time.Second
+
 // watchLoop is the main watch loop of journald watcher.
 func (j *journaldWatcher) watchLoop() {
 	startTimestamp := timeToJournalTimestamp(j.startTime)
+	lastCheckpoint := time.Now()
 	defer func() {
+		j.saveCheckpoint()
 		if err := j.journal.Close(); err != nil {
 			glog.Errorf("Failed to close journal client: %v", err)
 		}
@@ -106,6 +132,10 @@ func (j *journaldWatcher) watchLoop() {
 			return
 		default:
 		}
+		if time.Since(lastCheckpoint) >= checkpointInterval {
+			j.saveCheckpoint()
+			lastCheckpoint = time.Now()
+		}
 		// Get next log entry.
 		n, err := j.journal.Next()
 		if err != nil {
@@ -123,14 +153,20 @@ func (j *journaldWatcher) watchLoop() {
 			glog.Errorf("failed to get journal entry: %v", err)
 			continue
 		}
+		c := &checkpoint.Checkpoint{
+			Cursor:    entry.Cursor,
+			Timestamp: journalTimestampToTime(entry.RealtimeTimestamp),
+		}
 
 		if entry.RealtimeTimestamp < startTimestamp {
 			glog.V(5).Infof("Throwing away journal entry %q before start time: %v < %v",
 				entry.Fields[sdjournal.SD_JOURNAL_FIELD_MESSAGE], entry.RealtimeTimestamp, startTimestamp)
+			j.tracker.Skipped(c, len(j.logCh))
 			continue
 		}
 
-		j.logCh <- translate(entry)
+		j.logCh <- translate(entry, j.fields)
+		j.tracker.Sent(c, len(j.logCh))
 	}
 }
 
@@ -139,11 +175,20 @@ const (
 	defaultJournalLogPath = "/var/log/journal"
 
 	// configSourceKey is the key of source configuration in the plugin configuration.
+	// It is the comma separated syslog identifiers of the logs to watch.
 	configSourceKey = "source"
+	// configMatchKey is the key of the journal match expression in the plugin
+	// configuration. See parseMatches for the syntax.
+	configMatchKey = "match"
+	// configFieldsKey is the key of the comma separated journal fields to
+	// expose in the logs besides the default ones and the matched ones in the
+	// plugin configuration.
+	configFieldsKey = "fields"
 )
 
 // getJournal returns a journal client.
-func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journal, error) {
+func (j *journaldWatcher) getJournal() (*sdjournal.Journal, error) {
+	cfg, startTime := j.cfg, j.startTime
 	// Get journal log path.
 	path := defaultJournalLogPath
 	if cfg.LogPath != "" {
@@ -159,6 +204,24 @@ func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journa
 	if err != nil {
 		return nil, fmt.Errorf("failed to create journal client from path %q: %v", path, err)
 	}
+	// Watching the whole journal is not allowed and treated as an error.
+	if len(j.sources) == 0 && len(j.matches) == 0 {
+		journal.Close()
+		return nil, fmt.Errorf("failed to filter journal log, empty source and match are not allowed")
+	}
+	// Add the matches before seeking, so that seeking the cursor moves to the
+	// matched entries.
+	if err := addMatches(journal, j.sources, j.matches); err != nil {
+		journal.Close()
+		return nil, err
+	}
+	if cfg.Checkpoint != "" {
+		err := j.seekCheckpoint(journal)
+		if err == nil {
+			return journal, nil
+		}
+		glog.Warningf("Failed to resume from checkpoint %q, look back from %v instead: %v", cfg.Checkpoint, startTime, err)
+	}
 	// Seek journal client based on startTime.
 	seekTime := startTime
 	now := time.Now()
@@ -167,34 +230,103 @@ func getJournal(cfg types.WatcherConfig, startTime time.Time) (*sdjournal.Journa
 	}
 	err = journal.SeekRealtimeUsec(timeToJournalTimestamp(seekTime))
 	if err != nil {
+		journal.Close()
 		return nil, fmt.Errorf("failed to seek journal at %v (now %v): %v", seekTime, now, err)
 	}
-	// Empty source is not allowed and treated as an error.
-	source := cfg.PluginConfig[configSourceKey]
-	if source == "" {
-		return nil, fmt.Errorf("failed to filter journal log, empty source is not allowed")
+	return journal, nil
+}
+
+// seekCheckpoint seeks the journal to the cursor in the checkpoint, so that the
+// next entry is the first one not read yet. It returns error if the cursor is
+// no longer valid, e.g. the journal file of the cursor was vacuumed.
+func (j *journaldWatcher) seekCheckpoint(journal *sdjournal.Journal) error {
+	c, err := checkpoint.Load(j.cfg.Checkpoint)
+	if err != nil {
+		return err
 	}
-	match := sdjournal.Match{
-		Field: sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER,
-		Value: source,
+	if c.Cursor == "" {
+		return fmt.Errorf("no cursor in checkpoint")
 	}
-	err = journal.AddMatch(match.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to add log filter %#v: %v", match, err)
+	if err := journal.SeekCursor(c.Cursor); err != nil {
+		return fmt.Errorf("failed to seek cursor %q: %v", c.Cursor, err)
 	}
-	return journal, nil
+	// Seeking the cursor only positions the journal before the entry, move
+	// to the entry and check whether it is the entry of the cursor.
+	if _, err := journal.Next(); err != nil {
+		return fmt.Errorf("failed to move to the entry of cursor %q: %v", c.Cursor, err)
+	}
+	if err := journal.TestCursor(c.Cursor); err != nil {
+		return fmt.Errorf("cursor %q is no longer valid: %v", c.Cursor, err)
+	}
+	glog.Infof("Resume watching journald from checkpoint %+v", *c)
+	j.startTime = c.Timestamp
+	j.tracker = checkpoint.NewTracker(c)
+	return nil
 }
 
-// translate translates journal entry into internal type.
-func translate(entry *sdjournal.JournalEntry) *logtypes.Log {
-	timestamp := time.Unix(0, int64(time.Duration(entry.RealtimeTimestamp)*time.Microsecond))
+// saveCheckpoint saves the cursor of the last journal entry consumed from the
+// log channel in the checkpoint. The entries still in the log channel are read
+// again after restart.
+func (j *journaldWatcher) saveCheckpoint() {
+	if j.cfg.Checkpoint == "" {
+		return
+	}
+	c := j.tracker.Consumed(len(j.logCh))
+	if c == nil {
+		return
+	}
+	if err := checkpoint.Save(j.cfg.Checkpoint, c); err != nil {
+		glog.Errorf("Failed to save checkpoint: %v", err)
+	}
+}
+
+// logFields are the journal fields exposed in the log by default, so that rules
+// can be scoped by them.
+var logFields = []string{
+	sdjournal.SD_JOURNAL_FIELD_SYSTEMD_UNIT,
+	sdjournal.SD_JOURNAL_FIELD_PRIORITY,
+	sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER,
+	sdjournal.SD_JOURNAL_FIELD_PID,
+	sdjournal.SD_JOURNAL_FIELD_COMM,
+}
+
+// translate translates journal entry into internal type, exposing the fields.
+func translate(entry *sdjournal.JournalEntry, exposed []string) *logtypes.Log {
+	timestamp := journalTimestampToTime(entry.RealtimeTimestamp)
 	message := strings.TrimSpace(entry.Fields["MESSAGE"])
+	var fields map[string]string
+	for _, field := range exposed {
+		value, ok := entry.Fields[field]
+		if !ok {
+			continue
+		}
+		if fields == nil {
+			fields = map[string]string{}
+		}
+		fields[field] = value
+	}
 	return &logtypes.Log{
 		Timestamp: timestamp,
 		Message:   message,
+		Fields:    fields,
+	}
+}
+
+// splitList splits the comma separated list, dropping the empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
 
 func timeToJournalTimestamp(t time.Time) uint64 {
 	return uint64(t.UnixNano() / 1000)
 }
+
+func journalTimestampToTime(timestamp uint64) time.Time {
+	return time.Unix(0, int64(time.Duration(timestamp)*time.Microsecond))
+}
@@ -46,6 +46,28 @@ func TestTranslate(t *testing.T) {
 				Message:   "log message",
 			},
 		},
+		{
+			// has journal fields
+			entry: &sdjournal.JournalEntry{
+				Fields: map[string]string{
+					"MESSAGE":           "log message",
+					"_SYSTEMD_UNIT":     "docker.service",
+					"PRIORITY":          "3",
+					"SYSLOG_IDENTIFIER": "dockerd",
+					"_HOSTNAME":         "node",
+				},
+				RealtimeTimestamp: 123456789,
+			},
+			log: &logtypes.Log{
+				Timestamp: time.Unix(0, 123456789*1000),
+				Message:   "log message",
+				Fields: map[string]string{
+					"_SYSTEMD_UNIT":     "docker.service",
+					"PRIORITY":          "3",
+					"SYSLOG_IDENTIFIER": "dockerd",
+				},
+			},
+		},
 		{
 			// no log message
 			entry: &sdjournal.JournalEntry{
@@ -61,10 +83,30 @@ func TestTranslate(t *testing.T) {
 
 	for c, test := range testCases {
 		t.Logf("TestCase #%d: %#v", c+1, test)
-		assert.Equal(t, test.log, translate(test.entry))
+		assert.Equal(t, test.log, translate(test.entry, logFields))
 	}
 }
 
+func TestTranslateExposedFields(t *testing.T) {
+	entry := &sdjournal.JournalEntry{
+		Fields: map[string]string{
+			"MESSAGE":           "log message",
+			"SYSLOG_IDENTIFIER": "kernel",
+			"_TRANSPORT":        "kernel",
+			"_HOSTNAME":         "node",
+		},
+		RealtimeTimestamp: 123456789,
+	}
+	assert.Equal(t, &logtypes.Log{
+		Timestamp: time.Unix(0, 123456789*1000),
+		Message:   "log message",
+		Fields: map[string]string{
+			"SYSLOG_IDENTIFIER": "kernel",
+			"_TRANSPORT":        "kernel",
+		},
+	}, translate(entry, append(logFields, "_TRANSPORT")))
+}
+
 func TestGoroutineLeak(t *testing.T) {
 	orignal := runtime.NumGoroutine()
 	w := NewJournaldWatcher(types.WatcherConfig{
@@ -0,0 +1,149 @@
+// +build journald
+
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/go-systemd/sdjournal"
+)
+
+const (
+	// disjunction is the term separating the groups of matches in the match
+	// expression, the same as journalctl.
+	disjunction = "+"
+	// maxPriority is the max syslog priority, i.e. debug.
+	maxPriority = 7
+)
+
+// fieldNameRegexp matches the valid journal field names.
+var fieldNameRegexp = regexp.MustCompile(`^[A-Z0-9_]+$`)
+
+// parseMatches parses the match expression into the groups of matches. The
+// expression follows journalctl: Whitespace separated "FIELD=value" matches are
+// combined with AND, except that the matches of the same field are combined
+// with OR, and "+" combines the groups of matches with OR, e.g.
+// "_SYSTEMD_UNIT=kubelet.service PRIORITY<=3 + _TRANSPORT=kernel". "PRIORITY<=N"
+// and "PRIORITY>=N" are expanded to the matches of the priorities in range.
+func parseMatches(expr string) ([][]sdjournal.Match, error) {
+	var groups [][]sdjournal.Match
+	var group []sdjournal.Match
+	for _, term := range strings.Fields(expr) {
+		if term == disjunction {
+			if len(group) == 0 {
+				return nil, fmt.Errorf("empty group of matches in %q", expr)
+			}
+			groups = append(groups, group)
+			group = nil
+			continue
+		}
+		matches, err := parseTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("invalid match %q in %q: %v", term, expr, err)
+		}
+		group = append(group, matches...)
+	}
+	if len(group) == 0 {
+		if len(groups) > 0 {
+			return nil, fmt.Errorf("empty group of matches in %q", expr)
+		}
+		return nil, nil
+	}
+	return append(groups, group), nil
+}
+
+// parseTerm parses a term of the match expression into the matches.
+func parseTerm(term string) ([]sdjournal.Match, error) {
+	for _, op := range []string{"<=", ">="} {
+		i := strings.Index(term, op)
+		if i < 0 {
+			continue
+		}
+		field, value := term[:i], term[i+len(op):]
+		if field != sdjournal.SD_JOURNAL_FIELD_PRIORITY {
+			return nil, fmt.Errorf("%q is only supported by %s", op, sdjournal.SD_JOURNAL_FIELD_PRIORITY)
+		}
+		priority, err := strconv.Atoi(value)
+		if err != nil || priority < 0 || priority > maxPriority {
+			return nil, fmt.Errorf("invalid priority %q", value)
+		}
+		low, high := 0, priority
+		if op == ">=" {
+			low, high = priority, maxPriority
+		}
+		var matches []sdjournal.Match
+		for p := low; p <= high; p++ {
+			matches = append(matches, sdjournal.Match{Field: field, Value: strconv.Itoa(p)})
+		}
+		return matches, nil
+	}
+	i := strings.Index(term, "=")
+	if i < 0 {
+		return nil, fmt.Errorf("expect FIELD=value")
+	}
+	field := term[:i]
+	if !fieldNameRegexp.MatchString(field) {
+		return nil, fmt.Errorf("invalid field name %q", field)
+	}
+	return []sdjournal.Match{{Field: field, Value: term[i+1:]}}, nil
+}
+
+// addMatches adds the groups of matches to the journal, combined with AND with
+// the matches of the sources. Matches of the same field are combined with OR
+// by journald.
+func addMatches(journal *sdjournal.Journal, sources []string, groups [][]sdjournal.Match) error {
+	for _, source := range sources {
+		m := sdjournal.Match{Field: sdjournal.SD_JOURNAL_FIELD_SYSLOG_IDENTIFIER, Value: source}
+		if err := journal.AddMatch(m.String()); err != nil {
+			return fmt.Errorf("failed to add log filter %q: %v", m.String(), err)
+		}
+	}
+	if len(sources) > 0 && len(groups) > 0 {
+		if err := journal.AddConjunction(); err != nil {
+			return fmt.Errorf("failed to add conjunction: %v", err)
+		}
+	}
+	for i, group := range groups {
+		if i > 0 {
+			if err := journal.AddDisjunction(); err != nil {
+				return fmt.Errorf("failed to add disjunction: %v", err)
+			}
+		}
+		for _, m := range group {
+			if err := journal.AddMatch(m.String()); err != nil {
+				return fmt.Errorf("failed to add log filter %q: %v", m.String(), err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchFields returns the fields of the matches.
+func matchFields(groups [][]sdjournal.Match) []string {
+	var fields []string
+	for _, group := range groups {
+		for _, m := range group {
+			fields = append(fields, m.Field)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,105 @@
+// +build journald
+
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package journald
+
+import (
+	"testing"
+
+	"github.com/coreos/go-systemd/sdjournal"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMatches(t *testing.T) {
+	for desc, test := range map[string]struct {
+		expr     string
+		expected [][]sdjournal.Match
+		isErr    bool
+	}{
+		"empty expression": {
+			expr: "",
+		},
+		"single match": {
+			expr:     "_SYSTEMD_UNIT=kubelet.service",
+			expected: [][]sdjournal.Match{{{Field: "_SYSTEMD_UNIT", Value: "kubelet.service"}}},
+		},
+		"conjunction and disjunction": {
+			expr: "_SYSTEMD_UNIT=kubelet.service _SYSTEMD_UNIT=containerd.service  PRIORITY<=2 + _TRANSPORT=kernel",
+			expected: [][]sdjournal.Match{
+				{
+					{Field: "_SYSTEMD_UNIT", Value: "kubelet.service"},
+					{Field: "_SYSTEMD_UNIT", Value: "containerd.service"},
+					{Field: "PRIORITY", Value: "0"},
+					{Field: "PRIORITY", Value: "1"},
+					{Field: "PRIORITY", Value: "2"},
+				},
+				{
+					{Field: "_TRANSPORT", Value: "kernel"},
+				},
+			},
+		},
+		"priority at least": {
+			expr: "PRIORITY>=6",
+			expected: [][]sdjournal.Match{{
+				{Field: "PRIORITY", Value: "6"},
+				{Field: "PRIORITY", Value: "7"},
+			}},
+		},
+		"empty value": {
+			expr:     "CONTAINER_NAME=",
+			expected: [][]sdjournal.Match{{{Field: "CONTAINER_NAME", Value: ""}}},
+		},
+		"comparison of other fields": {
+			expr:  "_PID<=100",
+			isErr: true,
+		},
+		"invalid priority": {
+			expr:  "PRIORITY<=8",
+			isErr: true,
+		},
+		"invalid field name": {
+			expr:  "_systemd_unit=kubelet.service",
+			isErr: true,
+		},
+		"missing value": {
+			expr:  "_SYSTEMD_UNIT",
+			isErr: true,
+		},
+		"leading disjunction": {
+			expr:  "+ _TRANSPORT=kernel",
+			isErr: true,
+		},
+		"trailing disjunction": {
+			expr:  "_TRANSPORT=kernel +",
+			isErr: true,
+		},
+	} {
+		groups, err := parseMatches(test.expr)
+		if test.isErr {
+			assert.Error(t, err, desc)
+			continue
+		}
+		assert.NoError(t, err, desc)
+		assert.Equal(t, test.expected, groups, desc)
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	assert.Nil(t, splitList(""))
+	assert.Equal(t, []string{"kubelet", "containerd", "systemd"}, splitList("kubelet, containerd,,systemd "))
+}
@@ -18,6 +18,7 @@ package kmsg
 
 import (
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
@@ -31,14 +32,47 @@ import (
 	"k8s.io/node-problem-detector/pkg/util/tomb"
 )
 
+const (
+	// PriorityField is the field of the log level of the kernel log, from 0
+	// (emerg) to 7 (debug). It is named after the journal field, so that rules
+	// on it work for both kernel logs and journal logs.
+	PriorityField = "PRIORITY"
+	// FacilityField is the field of the syslog facility of the kernel log.
+	FacilityField = "SYSLOG_FACILITY"
+	// SequenceNumberField is the field of the sequence number of the kernel log.
+	SequenceNumberField = "SEQNUM"
+	// LostField is the field of the number of kernel logs lost. It is only set
+	// on the log reporting a sequence gap.
+	LostField = "LOST"
+	// HealthField is the field of the health of the kernel log watcher, "down"
+	// or "up". It is only set on the logs reporting the kernel log watcher
+	// failing to read /dev/kmsg and recovering.
+	HealthField = "WATCHER_HEALTH"
+)
+
+const (
+	// kmsgPath is the path of the kernel log device read by the kmsg parser.
+	kmsgPath = "/dev/kmsg"
+	// minReopenInterval is the initial interval to reopen the kernel log device
+	// after the kmsg parser stops. It doubles after each failure.
+	minReopenInterval = 500 * time.Millisecond
+	// maxReopenInterval is the max interval to reopen the kernel log device.
+	maxReopenInterval = 30 * time.Second
+)
+
 type kernelLogWatcher struct {
 	cfg       types.WatcherConfig
 	startTime time.Time
 	logCh     chan *logtypes.Log
 	tomb      *tomb.Tomb
+	// lastSequenceNumber is the sequence number of the last kernel log read,
+	// or -1 if no kernel log has been read.
+	lastSequenceNumber int
 
 	kmsgParser kmsgparser.Parser
-	clock      utilclock.Clock
+	// newParser creates the kmsg parser, overridden in tests.
+	newParser func() (kmsgparser.Parser, error)
+	clock     utilclock.Clock
 }
 
 // NewKmsgWatcher creates a watcher which will read messages from /dev/kmsg
@@ -57,8 +91,10 @@ func NewKmsgWatcher(cfg types.WatcherConfig) types.LogWatcher {
 		startTime: startTime,
 		tomb:      tomb.NewTomb(),
 		// Arbitrary capacity
-		logCh: make(chan *logtypes.Log, 100),
-		clock: utilclock.NewClock(),
+		logCh:              make(chan *logtypes.Log, 100),
+		newParser:          kmsgparser.NewParser,
+		clock:              utilclock.NewClock(),
+		lastSequenceNumber: -1,
 	}
 }
 
@@ -67,7 +103,7 @@ var _ types.WatcherCreateFunc = NewKmsgWatcher
 func (k *kernelLogWatcher) Watch() (<-chan *logtypes.Log, error) {
 	if k.kmsgParser == nil {
 		// nil-check to make mocking easier
-		parser, err := kmsgparser.NewParser()
+		parser, err := k.newParser()
 		if err != nil {
 			return nil, fmt.Errorf("failed to create kmsg parser: %v", err)
 		}
@@ -78,9 +114,9 @@ func (k *kernelLogWatcher) Watch() (<-chan *logtypes.Log, error) {
 	return k.logCh, nil
 }
 
-// Stop closes the kmsgparser
+// Stop stops the watch loop, which closes the kmsgparser. The kmsgparser is
+// replaced by the watch loop when it is reopened, so it is only closed there.
 func (k *kernelLogWatcher) Stop() {
-	k.kmsgParser.Close()
 	k.tomb.Stop()
 }
 
@@ -91,6 +127,11 @@ func (k *kernelLogWatcher) watchLoop() {
 		k.tomb.Done()
 	}()
 	kmsgs := k.kmsgParser.Parse()
+	// resumeAfter is the sequence number of the last kernel log read before the
+	// kmsg parser is reopened, or -1. The reopened kmsg parser reads from the
+	// oldest kernel log in the kernel log buffer, so the kernel logs up to it
+	// are skipped.
+	resumeAfter := -1
 
 	for {
 		select {
@@ -100,8 +141,30 @@ func (k *kernelLogWatcher) watchLoop() {
 				glog.Errorf("Failed to close kmsg parser: %v", err)
 			}
 			return
-		case msg := <-kmsgs:
+		case msg, ok := <-kmsgs:
+			if !ok {
+				// The kmsg parser closes the channel when it fails to read
+				// the kernel log device.
+				glog.Errorf("Kmsg parser stopped, reopen %s", kmsgPath)
+				if err := k.kmsgParser.Close(); err != nil {
+					glog.Errorf("Failed to close kmsg parser: %v", err)
+				}
+				if !k.reopen() {
+					glog.Infof("Stop watching kernel log")
+					return
+				}
+				kmsgs = k.kmsgParser.Parse()
+				resumeAfter = k.lastSequenceNumber
+				continue
+			}
 			glog.V(5).Infof("got kernel message: %+v", msg)
+			if resumeAfter >= 0 {
+				if msg.SequenceNumber <= resumeAfter {
+					continue
+				}
+				resumeAfter = -1
+			}
+			lost := k.checkSequenceNumber(msg.SequenceNumber)
 			if msg.Message == "" {
 				continue
 			}
@@ -112,10 +175,102 @@ func (k *kernelLogWatcher) watchLoop() {
 				continue
 			}
 
-			k.logCh <- &logtypes.Log{
+			if lost > 0 {
+				glog.Warningf("Lost %d kernel log messages before sequence number %d", lost, msg.SequenceNumber)
+				if !k.send(&logtypes.Log{
+					Message:   fmt.Sprintf("Lost %d kernel log messages before sequence number %d, the kernel log buffer overran", lost, msg.SequenceNumber),
+					Timestamp: msg.Timestamp,
+					Fields: map[string]string{
+						LostField:           strconv.Itoa(lost),
+						SequenceNumberField: strconv.Itoa(msg.SequenceNumber),
+					},
+				}) {
+					continue
+				}
+			}
+			k.send(&logtypes.Log{
 				Message:   strings.TrimSpace(msg.Message),
 				Timestamp: msg.Timestamp,
+				Fields:    translateFields(msg),
+			})
+		}
+	}
+}
+
+// send sends the log to the log channel. It returns false without sending the
+// log if the watcher is stopped, so that a full log channel doesn't block
+// stopping the watcher.
+func (k *kernelLogWatcher) send(log *logtypes.Log) bool {
+	select {
+	case k.logCh <- log:
+		return true
+	case <-k.tomb.Stopping():
+		return false
+	}
+}
+
+// reopen reports the kernel log watcher down, and reopens the kernel log device
+// with backoff until it succeeds or the watcher is stopped. It reports the
+// kernel log watcher up and returns true once the kernel log device is
+// reopened, or returns false if the watcher is stopped.
+func (k *kernelLogWatcher) reopen() bool {
+	if !k.send(&logtypes.Log{
+		Message:   fmt.Sprintf("Kernel log watcher is down, failed to read %s", kmsgPath),
+		Timestamp: k.clock.Now(),
+		Fields:    map[string]string{HealthField: "down"},
+	}) {
+		return false
+	}
+	interval := minReopenInterval
+	for attempt := 1; ; attempt++ {
+		select {
+		case <-k.tomb.Stopping():
+			return false
+		case <-k.clock.After(interval):
+		}
+		parser, err := k.newParser()
+		if err == nil {
+			glog.Infof("Reopened %s after %d attempts", kmsgPath, attempt)
+			k.kmsgParser = parser
+			if !k.send(&logtypes.Log{
+				Message:   fmt.Sprintf("Kernel log watcher is up, reopened %s", kmsgPath),
+				Timestamp: k.clock.Now(),
+				Fields:    map[string]string{HealthField: "up"},
+			}) {
+				if err := parser.Close(); err != nil {
+					glog.Errorf("Failed to close kmsg parser: %v", err)
+				}
+				return false
 			}
+			return true
+		}
+		glog.Errorf("Failed to reopen %s (attempt %d): %v", kmsgPath, attempt, err)
+		if interval *= 2; interval > maxReopenInterval {
+			interval = maxReopenInterval
 		}
 	}
 }
+
+// checkSequenceNumber records the sequence number of a kernel log, and returns
+// the number of kernel logs lost before it. The kernel drops the oldest logs
+// when the kernel log buffer overruns before they are read, which leaves a gap
+// in the sequence numbers.
+func (k *kernelLogWatcher) checkSequenceNumber(seq int) int {
+	lost := 0
+	if k.lastSequenceNumber >= 0 && seq > k.lastSequenceNumber+1 {
+		lost = seq - k.lastSequenceNumber - 1
+	}
+	k.lastSequenceNumber = seq
+	return lost
+}
+
+// translateFields translates the syslog prefix and the sequence number of the
+// kernel log into the fields of the log. The syslog prefix combines the
+// facility and the log level as "facility << 3 | level".
+func translateFields(msg kmsgparser.Message) map[string]string {
+	return map[string]string{
+		PriorityField:       strconv.Itoa(msg.Priority & 7),
+		FacilityField:       strconv.Itoa(msg.Priority >> 3),
+		SequenceNumberField: strconv.Itoa(msg.SequenceNumber),
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package kmsg
 
 import (
+	"fmt"
 	"testing"
 
 	"code.cloudfoundry.org/clock/fakeclock"
@@ -32,6 +33,9 @@ import (
 
 type mockKmsgParser struct {
 	kmsgs []kmsgparser.Message
+	// closed closes the channel after the messages, as if the kmsg parser
+	// failed to read the kernel log device.
+	closed bool
 }
 
 func (m *mockKmsgParser) SetLogger(kmsgparser.Logger) {}
@@ -42,6 +46,9 @@ func (m *mockKmsgParser) Parse() <-chan kmsgparser.Message {
 		for _, msg := range m.kmsgs {
 			c <- msg
 		}
+		if m.closed {
+			close(c)
+		}
 	}()
 	return c
 }
@@ -158,6 +165,11 @@ func TestWatch(t *testing.T) {
 		}
 		defer w.Stop()
 		for _, expected := range test.logs {
+			expected.Fields = map[string]string{
+				PriorityField:       "0",
+				FacilityField:       "0",
+				SequenceNumberField: "0",
+			}
 			got := <-logCh
 			assert.Equal(t, &expected, got)
 		}
@@ -171,3 +183,132 @@ func TestWatch(t *testing.T) {
 		}
 	}
 }
+
+func TestSequenceGap(t *testing.T) {
+	now := time.Now()
+	w := NewKmsgWatcher(types.WatcherConfig{})
+	w.(*kernelLogWatcher).startTime = now
+	w.(*kernelLogWatcher).kmsgParser = &mockKmsgParser{kmsgs: []kmsgparser.Message{
+		// The gap before the start time is not reported.
+		{Message: "1", SequenceNumber: 10, Timestamp: now.Add(-time.Second)},
+		{Message: "2", SequenceNumber: 12, Timestamp: now.Add(-time.Second)},
+		{Message: "3", SequenceNumber: 13, Priority: 6, Timestamp: now},
+		{Message: "4", SequenceNumber: 17, Priority: 3<<3 | 3, Timestamp: now.Add(time.Second)},
+	}}
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+	for _, expected := range []*logtypes.Log{
+		{
+			Timestamp: now,
+			Message:   "3",
+			Fields:    map[string]string{PriorityField: "6", FacilityField: "0", SequenceNumberField: "13"},
+		},
+		{
+			Timestamp: now.Add(time.Second),
+			Message:   "Lost 3 kernel log messages before sequence number 17, the kernel log buffer overran",
+			Fields:    map[string]string{LostField: "3", SequenceNumberField: "17"},
+		},
+		{
+			Timestamp: now.Add(time.Second),
+			Message:   "4",
+			Fields:    map[string]string{PriorityField: "3", FacilityField: "3", SequenceNumberField: "17"},
+		},
+	} {
+		assert.Equal(t, expected, <-logCh)
+	}
+}
+
+func TestReopen(t *testing.T) {
+	now := time.Now()
+	fakeClock := fakeclock.NewFakeClock(now)
+	w := NewKmsgWatcher(types.WatcherConfig{})
+	w.(*kernelLogWatcher).startTime = now
+	w.(*kernelLogWatcher).clock = fakeClock
+	w.(*kernelLogWatcher).kmsgParser = &mockKmsgParser{
+		kmsgs: []kmsgparser.Message{
+			{Message: "1", SequenceNumber: 1, Timestamp: now},
+			{Message: "2", SequenceNumber: 2, Timestamp: now},
+		},
+		closed: true,
+	}
+	attempts := 0
+	w.(*kernelLogWatcher).newParser = func() (kmsgparser.Parser, error) {
+		attempts++
+		if attempts == 1 {
+			return nil, fmt.Errorf("failed to open /dev/kmsg")
+		}
+		// The reopened parser reads from the oldest kernel log.
+		return &mockKmsgParser{kmsgs: []kmsgparser.Message{
+			{Message: "1", SequenceNumber: 1, Timestamp: now},
+			{Message: "2", SequenceNumber: 2, Timestamp: now},
+			{Message: "3", SequenceNumber: 3, Timestamp: now},
+			{Message: "5", SequenceNumber: 5, Timestamp: now},
+		}}, nil
+	}
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+
+	for _, expected := range []string{"1", "2", "Kernel log watcher is down, failed to read /dev/kmsg"} {
+		assert.Equal(t, expected, (<-logCh).Message)
+	}
+	// The first attempt fails, and the second attempt backs off.
+	fakeClock.WaitForWatcherAndIncrement(minReopenInterval)
+	fakeClock.WaitForWatcherAndIncrement(2 * minReopenInterval)
+	up := <-logCh
+	assert.Equal(t, "Kernel log watcher is up, reopened /dev/kmsg", up.Message)
+	assert.Equal(t, map[string]string{HealthField: "up"}, up.Fields)
+	assert.Equal(t, 2, attempts)
+	// The kernel logs already read are skipped.
+	for _, expected := range []string{"3", "Lost 1 kernel log messages before sequence number 5, the kernel log buffer overran", "5"} {
+		assert.Equal(t, expected, (<-logCh).Message)
+	}
+}
+
+func TestStopWhileReopening(t *testing.T) {
+	w := NewKmsgWatcher(types.WatcherConfig{})
+	w.(*kernelLogWatcher).clock = fakeclock.NewFakeClock(time.Now())
+	w.(*kernelLogWatcher).kmsgParser = &mockKmsgParser{closed: true}
+	w.(*kernelLogWatcher).newParser = func() (kmsgparser.Parser, error) {
+		return nil, fmt.Errorf("failed to open /dev/kmsg")
+	}
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	down := <-logCh
+	assert.Equal(t, map[string]string{HealthField: "down"}, down.Fields)
+	w.Stop()
+	_, ok := <-logCh
+	assert.False(t, ok)
+}
+
+func TestStopWithFullLogChannel(t *testing.T) {
+	now := time.Now()
+	for desc, parser := range map[string]*mockKmsgParser{
+		"health log": {closed: true},
+		"kernel log": {kmsgs: []kmsgparser.Message{{Message: "1", SequenceNumber: 1, Timestamp: now}}},
+		"lost kernel logs": {kmsgs: []kmsgparser.Message{
+			{Message: "1", SequenceNumber: 1, Timestamp: now},
+			{Message: "3", SequenceNumber: 3, Timestamp: now},
+		}},
+	} {
+		w := NewKmsgWatcher(types.WatcherConfig{})
+		// The log channel is full, so no log can be sent.
+		w.(*kernelLogWatcher).logCh = make(chan *logtypes.Log)
+		w.(*kernelLogWatcher).startTime = now
+		w.(*kernelLogWatcher).clock = fakeclock.NewFakeClock(now)
+		w.(*kernelLogWatcher).kmsgParser = parser
+		_, err := w.Watch()
+		assert.NoError(t, err, desc)
+		stopped := make(chan struct{})
+		go func() {
+			w.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(10 * time.Second):
+			t.Errorf("%s: timeout waiting for watcher to stop", desc)
+		}
+	}
+}
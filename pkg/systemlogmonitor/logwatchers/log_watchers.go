@@ -24,17 +24,12 @@ import (
 
 // createFuncs is a table of createFuncs for all supported log watchers.
 var createFuncs = map[string]types.WatcherCreateFunc{}
-var createSensuFuncs = map[string]types.SensuWatcherCreateFunc{}
 
 // registerLogWatcher registers a createFunc for a log watcher.
 func registerLogWatcher(name string, create types.WatcherCreateFunc) {
 	createFuncs[name] = create
 }
 
-func registerSensuLogWatcher(name string, create types.SensuWatcherCreateFunc) {
-	createSensuFuncs[name] = create
-}
-
 // GetLogWatcherOrDie get a log watcher based on the passed in configuration.
 // The function panics when encounters an error.
 func GetLogWatcherOrDie(config types.WatcherConfig) types.LogWatcher {
@@ -45,13 +40,3 @@ func GetLogWatcherOrDie(config types.WatcherConfig) types.LogWatcher {
 	glog.Infof("Use log watcher of plugin %q", config.Plugin)
 	return create(config)
 }
-
-
-func GetSensuLogWatcherOrDie(config types.WatcherConfig) types.SensuLogWatcher {
-	create, ok := createSensuFuncs[config.Plugin]
-	if !ok {
-		glog.Fatalf("No create function found for plugin %q", config.Plugin)
-	}
-	glog.Infof("Use log watcher of plugin %q", config.Plugin)
-	return create(config)
-}
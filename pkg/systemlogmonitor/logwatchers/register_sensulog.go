@@ -20,6 +20,6 @@ import (
 const sensulogPluginName = "sensulog"
 
 func init() {
-	// Register the filelog plugin.
-	registerSensuLogWatcher(sensulogPluginName, sensulog.NewSyslogWatcherOrDie)
+	// Register the sensulog plugin.
+	registerLogWatcher(sensulogPluginName, sensulog.NewSyslogWatcherOrDie)
 }
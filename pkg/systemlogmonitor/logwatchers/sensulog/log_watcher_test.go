@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sensulog
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/filelog"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+)
+
+func TestWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "log_watcher_test")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sensu-client.log")
+	executed := time.Now().Unix()
+	event := fmt.Sprintf(`{"timestamp":%d,"entity":{"metadata":{"name":"node-1"}},`+
+		`"check":{"metadata":{"name":"ntp"},"interval":30,"executed":%d,"output":"offset 2s","status":1}}`, executed, executed)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("not a check result\n"+event+"\n"), 0644))
+
+	w := NewSyslogWatcherOrDie(types.WatcherConfig{
+		Plugin:   "sensulog",
+		LogPath:  path,
+		Lookback: "1h",
+	})
+	logCh, err := w.Watch()
+	assert.NoError(t, err)
+	defer w.Stop()
+	select {
+	case got := <-logCh:
+		assert.Equal(t, time.Unix(executed, 0), got.Timestamp)
+		assert.Equal(t, "offset 2s", got.Message)
+		assert.Equal(t, "ntp", got.Fields[CheckField])
+		assert.Equal(t, "1", got.Fields[StatusField])
+		assert.Equal(t, path, got.Fields[filelog.FileField])
+	case <-time.After(30 * time.Second):
+		t.Errorf("timeout waiting for log")
+	}
+}
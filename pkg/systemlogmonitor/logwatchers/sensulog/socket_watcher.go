@@ -0,0 +1,264 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sensulog
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	utilclock "code.cloudfoundry.org/clock"
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	// addressKey is the key of the listen address in the plugin configuration.
+	addressKey = "address"
+	// protocolsKey is the key of the comma separated protocols to listen on in
+	// the plugin configuration. Supported protocols are tcp and udp.
+	protocolsKey = "protocols"
+	// clientKey is the key of the client name reported with the check results
+	// in the plugin configuration. Defaults to the hostname.
+	clientKey = "client"
+
+	// defaultAddress is the default address of the sensu client socket.
+	defaultAddress = "127.0.0.1:3030"
+	// defaultProtocols are the default protocols of the sensu client socket.
+	defaultProtocols = "tcp,udp"
+)
+
+// socketWatcher implements the sensu client socket input, which receives
+// check results in json over tcp and udp.
+// See https://docs.sensu.io/sensu-core/1.4/reference/clients/#client-socket-input
+type socketWatcher struct {
+	cfg       types.WatcherConfig
+	address   string
+	protocols []string
+	client    string
+	listeners []net.Listener
+	conns     []net.PacketConn
+	logCh     chan *logtypes.Log
+	tomb      *tomb.Tomb
+	clock     utilclock.Clock
+	// wg waits for all the goroutines sending logs.
+	wg sync.WaitGroup
+}
+
+// NewSocketWatcherOrDie creates a new sensu client socket watcher. The function
+// panics when encounters an error.
+func NewSocketWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
+	address := cfg.PluginConfig[addressKey]
+	if address == "" {
+		address = defaultAddress
+	}
+	protocols := cfg.PluginConfig[protocolsKey]
+	if protocols == "" {
+		protocols = defaultProtocols
+	}
+	w := &socketWatcher{
+		cfg:     cfg,
+		address: address,
+		client:  cfg.PluginConfig[clientKey],
+		tomb:    tomb.NewTomb(),
+		// A capacity 1000 buffer should be enough
+		logCh: make(chan *logtypes.Log, 1000),
+		clock: utilclock.NewClock(),
+	}
+	for _, protocol := range strings.Split(protocols, ",") {
+		protocol = strings.TrimSpace(protocol)
+		if protocol != "tcp" && protocol != "udp" {
+			glog.Fatalf("Unsupported sensu client socket protocol %q", protocol)
+		}
+		w.protocols = append(w.protocols, protocol)
+	}
+	if w.client == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			glog.Fatalf("Failed to get hostname: %v", err)
+		}
+		w.client = hostname
+	}
+	return w
+}
+
+// Make sure NewSocketWatcherOrDie is types.WatcherCreateFunc.
+var _ types.WatcherCreateFunc = NewSocketWatcherOrDie
+
+// Watch starts listening on the sensu client socket.
+func (w *socketWatcher) Watch() (<-chan *logtypes.Log, error) {
+	for _, protocol := range w.protocols {
+		var err error
+		switch protocol {
+		case "tcp":
+			var l net.Listener
+			if l, err = net.Listen("tcp", w.address); err == nil {
+				w.listeners = append(w.listeners, l)
+			}
+		case "udp":
+			var c net.PacketConn
+			if c, err = net.ListenPacket("udp", w.address); err == nil {
+				w.conns = append(w.conns, c)
+			}
+		}
+		if err != nil {
+			w.closeSockets()
+			return nil, fmt.Errorf("failed to listen on %s %q: %v", protocol, w.address, err)
+		}
+	}
+	glog.Infof("Start watching sensu client socket %q", w.address)
+	for _, l := range w.listeners {
+		w.wg.Add(1)
+		go w.acceptLoop(l)
+	}
+	for _, c := range w.conns {
+		w.wg.Add(1)
+		go w.readLoop(c)
+	}
+	go w.watchLoop()
+	return w.logCh, nil
+}
+
+// Stop stops the sensu client socket watcher.
+func (w *socketWatcher) Stop() {
+	w.tomb.Stop()
+}
+
+// watchLoop waits for the watcher to stop and cleans up.
+func (w *socketWatcher) watchLoop() {
+	defer func() {
+		close(w.logCh)
+		w.tomb.Done()
+	}()
+	<-w.tomb.Stopping()
+	glog.Infof("Stop watching sensu client socket")
+	w.closeSockets()
+	w.wg.Wait()
+}
+
+func (w *socketWatcher) closeSockets() {
+	for _, l := range w.listeners {
+		l.Close()
+	}
+	for _, c := range w.conns {
+		c.Close()
+	}
+}
+
+// connTimeout is the timeout of reading a check result from a tcp connection.
+const connTimeout = 10 * time.Second
+
+// acceptLoop accepts the tcp connections until the listener is closed.
+func (w *socketWatcher) acceptLoop(l net.Listener) {
+	defer w.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-w.tomb.Stopping():
+			default:
+				glog.Errorf("Exiting sensu client socket accept loop with error: %v", err)
+			}
+			return
+		}
+		w.wg.Add(1)
+		go w.handleConn(conn)
+	}
+}
+
+// handleConn reads one check result from the tcp connection, and replies "ok"
+// or "invalid". It replies "pong" to "ping" for health checking.
+func (w *socketWatcher) handleConn(conn net.Conn) {
+	defer w.wg.Done()
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(connTimeout))
+	r := bufio.NewReader(conn)
+	// A check result is a json object, so only a ping could start with 'p'.
+	if b, err := r.Peek(1); err == nil && b[0] == 'p' {
+		ping := make([]byte, 4)
+		if _, err := io.ReadFull(r, ping); err == nil && string(ping) == "ping" {
+			io.WriteString(conn, "pong")
+			return
+		}
+	}
+	var check SensuCheck
+	if err := json.NewDecoder(r).Decode(&check); err != nil {
+		glog.Warningf("Unable to decode check result from %v: %v", conn.RemoteAddr(), err)
+		io.WriteString(conn, "invalid")
+		return
+	}
+	if err := w.send(check); err != nil {
+		glog.Warningf("Invalid check result from %v: %v", conn.RemoteAddr(), err)
+		io.WriteString(conn, "invalid")
+		return
+	}
+	io.WriteString(conn, "ok")
+}
+
+// maxDatagramSize is the max size of a udp datagram.
+const maxDatagramSize = 65535
+
+// readLoop reads the check results from the udp socket until it is closed.
+// Each datagram is a check result.
+func (w *socketWatcher) readLoop(c net.PacketConn) {
+	defer w.wg.Done()
+	buf := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := c.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-w.tomb.Stopping():
+			default:
+				glog.Errorf("Exiting sensu client socket read loop with error: %v", err)
+			}
+			return
+		}
+		var check SensuCheck
+		if err := json.Unmarshal(buf[:n], &check); err != nil {
+			glog.Warningf("Unable to decode check result from %v: %v", addr, err)
+			continue
+		}
+		if err := w.send(check); err != nil {
+			glog.Warningf("Invalid check result from %v: %v", addr, err)
+		}
+	}
+}
+
+// send validates the check result and sends it to the log channel.
+func (w *socketWatcher) send(check SensuCheck) error {
+	if check.Name == "" {
+		return fmt.Errorf("check name is not set")
+	}
+	timestamp := w.clock.Now()
+	if check.Executed > 0 {
+		timestamp = time.Unix(int64(check.Executed), 0)
+	}
+	select {
+	case w.logCh <- checkToLog(w.client, check, timestamp):
+	case <-w.tomb.Stopping():
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sensulog
+
+import (
+	"io/ioutil"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func newTestSocketWatcher(t *testing.T, protocol string) (*socketWatcher, <-chan *logtypes.Log, string) {
+	w := NewSocketWatcherOrDie(types.WatcherConfig{
+		Plugin: "sensusocket",
+		PluginConfig: map[string]string{
+			"address":   "127.0.0.1:0",
+			"protocols": protocol,
+			"client":    "node-1",
+		},
+	}).(*socketWatcher)
+	w.clock = fakeclock.NewFakeClock(time.Unix(1000, 0))
+	logCh, err := w.Watch()
+	require.NoError(t, err)
+	var address string
+	if protocol == "tcp" {
+		address = w.listeners[0].Addr().String()
+	} else {
+		address = w.conns[0].LocalAddr().String()
+	}
+	return w, logCh, address
+}
+
+// sendTCP sends the data over tcp and returns the reply.
+func sendTCP(t *testing.T, address, data string) string {
+	conn, err := net.Dial("tcp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Write([]byte(data))
+	require.NoError(t, err)
+	reply, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	return string(reply)
+}
+
+func receiveLog(t *testing.T, logCh <-chan *logtypes.Log) *logtypes.Log {
+	select {
+	case log := <-logCh:
+		return log
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for log")
+	}
+	return nil
+}
+
+func TestSocketWatcherTCP(t *testing.T) {
+	w, logCh, address := newTestSocketWatcher(t, "tcp")
+	defer w.Stop()
+
+	assert.Equal(t, "pong", sendTCP(t, address, "ping"))
+	assert.Equal(t, "invalid", sendTCP(t, address, `{"output": "no name"}`))
+	assert.Equal(t, "invalid", sendTCP(t, address, `not json`))
+
+	assert.Equal(t, "ok", sendTCP(t, address, `{"name": "disk", "output": "disk full", "status": 2}`))
+	assert.Equal(t, &logtypes.Log{
+		Timestamp: time.Unix(1000, 0),
+		Message:   "disk full",
+		Fields: map[string]string{
+			CheckField:       "disk",
+			StatusField:      "2",
+			ClientField:      "node-1",
+			OccurrencesField: "0",
+			IntervalField:    "0",
+		},
+	}, receiveLog(t, logCh))
+
+	// The executed time of the check is used as the timestamp.
+	assert.Equal(t, "ok", sendTCP(t, address, `{"name": "ntp", "output": "ok", "status": 0, "executed": 2000}`))
+	log := receiveLog(t, logCh)
+	assert.Equal(t, "ntp", log.Fields[CheckField])
+	assert.Equal(t, time.Unix(2000, 0), log.Timestamp)
+}
+
+func TestSocketWatcherUDP(t *testing.T) {
+	w, logCh, address := newTestSocketWatcher(t, "udp")
+	defer w.Stop()
+
+	conn, err := net.Dial("udp", address)
+	require.NoError(t, err)
+	defer conn.Close()
+	for _, data := range []string{
+		`not json`,
+		`{"name": "disk", "output": "disk full", "status": 2, "interval": 60}`,
+	} {
+		_, err = conn.Write([]byte(data))
+		require.NoError(t, err)
+	}
+	log := receiveLog(t, logCh)
+	assert.Equal(t, "disk", log.Fields[CheckField])
+	assert.Equal(t, "60", log.Fields[IntervalField])
+	assert.Equal(t, "disk full", log.Message)
+}
+
+func TestSocketWatcherStop(t *testing.T) {
+	original := runtime.NumGoroutine()
+	w, logCh, _ := newTestSocketWatcher(t, "tcp,udp")
+	w.Stop()
+	select {
+	case _, ok := <-logCh:
+		assert.False(t, ok, "log channel should be closed")
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for watcher to stop")
+	}
+	assert.Equal(t, original, runtime.NumGoroutine())
+}
@@ -10,118 +10,288 @@ WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
 See the License for the specific language governing permissions and
 limitations under the License.
 */
+
 package sensulog
 
 import (
+	"encoding/json"
 	"fmt"
-	
+	"strconv"
+	"strings"
 	"time"
-	"encoding/json"
-	//"strings"
 
 	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
 
 	"github.com/golang/glog"
 )
 
-// translator translates sensu log line into internal log type based on user defined
-// translate line and return logtypes.SensuLog
+// SensuCheck is a sensu check result.
+type SensuCheck struct {
+	Command     string   `json:"command"`
+	Contacts    []string `json:"contacts"`
+	Handlers    []string `json:"handlers"`
+	Info        string   `json:"info"`
+	Interval    int      `json:"interval"`
+	Occurrences int      `json:"occurrences"`
+	Owner       string   `json:"owner"`
+	Refresh     int      `json:"refresh"`
+	Runbook     string   `json:"runbook"`
+	Slack       string   `json:"slack"`
+	Standalone  bool     `json:"standalone"`
+	Timeout     int      `json:"timeout"`
+	Name        string   `json:"name"`
+	Issued      int      `json:"issued"`
+	Executed    int      `json:"executed"`
+	Duration    float64  `json:"duration"`
+	Output      string   `json:"output"`
+	Status      int      `json:"status"`
+}
+
+// SensuJsonLog is a check result line in the sensu client log.
 type SensuJsonLog struct {
-    Timestamp string `json:"timestamp"`
-    Level     string `json:"level"`
-    Message   string `json:"message"`
-    Payload   struct {
-        Client string `json:"client"`
-        Check  struct {
-            Command     string   `json:"command"`
-            Contacts    []string `json:"contacts"`
-            Handlers    []string `json:"handlers"`
-            Info        string   `json:"info"`
-            Occurrences int      `json:"occurrences"`
-            Owner       string   `json:"owner"`
-            Refresh     int      `json:"refresh"`
-            Runbook     string   `json:"runbook"`
-            Slack       string   `json:"slack"`
-            Standalone  bool     `json:"standalone"`
-            Timeout     int      `json:"timeout"`
-            Name        string   `json:"name"`
-            Issued      int      `json:"issued"`
-            Executed    int      `json:"executed"`
-            Duration    float64  `json:"duration"`
-            Output      string   `json:"output"`
-            Status      int      `json:"status"`
-        } `json:"check"`
-    } `json:"payload"`
+	Timestamp string `json:"timestamp"`
+	Level     string `json:"level"`
+	Message   string `json:"message"`
+	Payload   struct {
+		Client string     `json:"client"`
+		Check  SensuCheck `json:"check"`
+	} `json:"payload"`
 }
 
+// SensuGoEvent is a sensu go (5.x and later) event.
+type SensuGoEvent struct {
+	// Timestamp is the time of the event in epoch seconds.
+	Timestamp int64 `json:"timestamp"`
+	Entity    struct {
+		Metadata SensuGoMetadata `json:"metadata"`
+	} `json:"entity"`
+	Check *struct {
+		Metadata    SensuGoMetadata `json:"metadata"`
+		Command     string          `json:"command"`
+		Handlers    []string        `json:"handlers"`
+		Interval    int             `json:"interval"`
+		Occurrences int             `json:"occurrences"`
+		Timeout     int             `json:"timeout"`
+		Issued      int             `json:"issued"`
+		Executed    int             `json:"executed"`
+		Duration    float64         `json:"duration"`
+		Output      string          `json:"output"`
+		Status      int             `json:"status"`
+	} `json:"check"`
+}
+
+// SensuGoMetadata is the metadata of sensu go resources.
+type SensuGoMetadata struct {
+	Name        string            `json:"name"`
+	Namespace   string            `json:"namespace"`
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// The structured fields of the logs translated from sensu check results. The
+// check output is the message of the log.
+const (
+	// CheckField is the name of the sensu check.
+	CheckField = "check"
+	// StatusField is the exit status code of the sensu check.
+	StatusField = "status"
+	// ClientField is the name of the sensu client running the check.
+	ClientField = "client"
+	// OccurrencesField is the number of occurrences configured for the check,
+	// i.e. the number of consecutive failures before the check is handled.
+	OccurrencesField = "occurrences"
+	// IntervalField is the interval of the check in seconds. It falls back to
+	// the refresh of the check if the interval is not set.
+	IntervalField = "interval"
+
+	// The following fields are the optional metadata of the check, which are
+	// only set when present in the check result.
+	// RunbookField is the runbook url of the check.
+	RunbookField = "runbook"
+	// OwnerField is the owner of the check, e.g. the owning team.
+	OwnerField = "owner"
+	// ContactsField are the comma separated contacts of the check.
+	ContactsField = "contacts"
+	// SlackField is the slack channel of the check.
+	SlackField = "slack"
+	// InfoField is the additional information of the check.
+	InfoField = "info"
+)
+
+// translator translates sensu check result log line into internal log type.
 type translator struct {
-	//sensuchecks string
+	format          string
 	timestampFormat string
 }
 
 const (
-	//checks = "checks"
+	// formatKey is the key of the sensu log format in the plugin configuration.
+	formatKey = "format"
+	// timestampFormatKey is the key of timestamp format string in the plugin configuration.
+	// It is only used by the sensu 1.x log format.
 	timestampFormatKey = "timestampFormat"
 )
 
+// The supported sensu log formats.
+const (
+	// formatAuto detects the format of each line.
+	formatAuto = "auto"
+	// formatV1 is the sensu 1.x client log format.
+	formatV1 = "1.x"
+	// formatGo is the sensu go event format.
+	formatGo = "go"
+)
+
 func newTranslatorOrDie(pluginConfig map[string]string) *translator {
 	if err := validatePluginConfig(pluginConfig); err != nil {
 		glog.Errorf("Failed to validate plugin configuration %+v: %v", pluginConfig, err)
 	}
-	
+	format := pluginConfig[formatKey]
+	if format == "" {
+		format = formatAuto
+	}
 	return &translator{
-		//sensuchecks: pluginConfig[checks],
+		format:          format,
 		timestampFormat: pluginConfig[timestampFormatKey],
 	}
 }
 
-// translate translates the log line into internal type.
+// Translate translates the log line into internal type. It returns nil without
+// error for the lines without check result.
+func (t *translator) Translate(line string) (*logtypes.Log, error) {
+	format := t.format
+	if format == formatAuto {
+		format = detectFormat(line)
+	}
+	if format == formatGo {
+		return translateGo(line)
+	}
+	return t.translateV1(line)
+}
 
-func (t *translator) translate(line string) (*logtypes.SensuLog, error) {
-	// Unmarshal Json line
+// detectFormat detects the sensu log format of the line. Sensu go events have
+// the check name in the check metadata, while sensu 1.x logs have the check
+// in the payload.
+func detectFormat(line string) string {
+	var probe struct {
+		Check *struct {
+			Metadata *json.RawMessage `json:"metadata"`
+		} `json:"check"`
+	}
+	if err := json.Unmarshal([]byte(line), &probe); err == nil && probe.Check != nil && probe.Check.Metadata != nil {
+		return formatGo
+	}
+	return formatV1
+}
+
+// translateV1 translates the sensu 1.x log line into internal type.
+func (t *translator) translateV1(line string) (*logtypes.Log, error) {
 	var sensulog SensuJsonLog
-	byt := []byte(line)
-	err := json.Unmarshal(byt, &sensulog)
-	if err != nil {
-		glog.Infof("Unable to unmarshall line %q", line)
-		return nil, fmt.Errorf("failed to unmarshal line ")
-	} else {
-		glog.Infof("Unmarshaled check: %q; output: %q", sensulog.Payload.Check.Name,sensulog.Payload.Check.Output)
+	if err := json.Unmarshal([]byte(line), &sensulog); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal line %q: %v", line, err)
+	}
+	// Only check results are interesting, skip the other sensu client logs,
+	// e.g. keepalives.
+	if sensulog.Payload.Check.Name == "" {
+		return nil, nil
 	}
-	
 	// Parse timestamp.
 	timestamp, err := time.ParseInLocation(t.timestampFormat, sensulog.Timestamp, time.Local)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse timestamp %q: %v", sensulog.Timestamp, err)
 	}
-	
-	//checks_list := strings.Split(t.sensuchecks, ",")
-	//var message string
-	// Loop through all checks and compare
-	/*for i := range checks_list {
-		if sensulog.Payload.Check.Name == checks_list[i]{
-			//need to apped all matched checks
-			message = "[" + checks_list[i] + ">>" + sensulog.Payload.Check.Output + "]"
+	return checkToLog(sensulog.Payload.Client, sensulog.Payload.Check, timestamp), nil
+}
+
+// translateGo translates the sensu go event into internal type.
+func translateGo(line string) (*logtypes.Log, error) {
+	var event SensuGoEvent
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal line %q: %v", line, err)
+	}
+	// Skip the events without check result, e.g. metrics.
+	if event.Check == nil || event.Check.Metadata.Name == "" {
+		return nil, nil
+	}
+	// Use the executed time of the check, and fall back to the event time.
+	executed := int64(event.Check.Executed)
+	if executed == 0 {
+		executed = event.Timestamp
+	}
+	if executed == 0 {
+		return nil, fmt.Errorf("no timestamp found in line %q", line)
+	}
+	annotations := event.Check.Metadata.Annotations
+	check := SensuCheck{
+		Name:     event.Check.Metadata.Name,
+		Command:  event.Check.Command,
+		Handlers: event.Check.Handlers,
+		Interval: event.Check.Interval,
+		// The occurrences of sensu go events is the number of consecutive
+		// events with the same status, not the occurrences configured for the
+		// check as in sensu 1.x, so it is not carried over.
+		Timeout:  event.Check.Timeout,
+		Issued:   event.Check.Issued,
+		Executed: int(executed),
+		Duration: event.Check.Duration,
+		Output:   event.Check.Output,
+		Status:   event.Check.Status,
+		// Sensu go has no dedicated fields for the check metadata, which are
+		// usually set as annotations.
+		Info:    annotations["info"],
+		Owner:   annotations["owner"],
+		Runbook: annotations["runbook"],
+		Slack:   annotations["slack"],
+	}
+	if contacts := annotations["contacts"]; contacts != "" {
+		check.Contacts = strings.Split(contacts, ",")
+	}
+	return checkToLog(event.Entity.Metadata.Name, check, time.Unix(executed, 0)), nil
+}
+
+// checkToLog converts a check result into internal log type.
+func checkToLog(client string, check SensuCheck, timestamp time.Time) *logtypes.Log {
+	interval := check.Interval
+	if interval == 0 {
+		interval = check.Refresh
+	}
+	glog.V(4).Infof("Translated check %q with status %d: %q", check.Name, check.Status, check.Output)
+	fields := map[string]string{
+		CheckField:       check.Name,
+		StatusField:      strconv.Itoa(check.Status),
+		ClientField:      client,
+		OccurrencesField: strconv.Itoa(check.Occurrences),
+		IntervalField:    strconv.Itoa(interval),
+	}
+	for field, value := range map[string]string{
+		RunbookField:  check.Runbook,
+		OwnerField:    check.Owner,
+		ContactsField: strings.Join(check.Contacts, ","),
+		SlackField:    check.Slack,
+		InfoField:     check.Info,
+	} {
+		if value != "" {
+			fields[field] = value
 		}
-	} */
-	if sensulog.Payload.Check.Name != "" {
-		return nil, fmt.Errorf("failed to parse timestamp %q: %v", sensulog.Timestamp, err)
 	}
-	
-	return &logtypes.SensuLog{
+	return &logtypes.Log{
 		Timestamp: timestamp,
-		Check:     sensulog.Payload.Check.Name,
-		Output:    sensulog.Payload.Check.Output,
-	}, nil
+		Message:   check.Output,
+		Fields:    fields,
+	}
 }
 
+// validatePluginConfig validates whether the plugin configuration.
 func validatePluginConfig(cfg map[string]string) error {
-	if cfg[timestampFormatKey] == "" {
-		return fmt.Errorf("unexpected empty timestamp regular expression")
+	format := cfg[formatKey]
+	switch format {
+	case "", formatAuto, formatV1, formatGo:
+	default:
+		return fmt.Errorf("unsupported sensu log format %q", format)
+	}
+	// Sensu go events carry epoch timestamps.
+	if format != formatGo && cfg[timestampFormatKey] == "" {
+		return fmt.Errorf("unexpected empty timestamp format string")
 	}
-	/*if cfg[checks] == "" {
-		return fmt.Errorf("unexpected empty checks")
-	} */
-	
 	return nil
 }
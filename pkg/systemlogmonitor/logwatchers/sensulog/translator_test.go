@@ -0,0 +1,160 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package sensulog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// getTestPluginConfig returns a plugin config for test.
+func getTestPluginConfig() map[string]string {
+	return map[string]string{
+		"timestampFormat": "2006-01-02T15:04:05.000000-0700",
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	goEvent := `{"timestamp":1525202625,"entity":{"metadata":{"name":"node-2"}},` +
+		`"check":{"metadata":{"name":"ntp","annotations":{"runbook":"https://runbooks/ntp"}},` +
+		`"interval":30,"occurrences":2,"executed":1525202600,"output":"offset 2s","status":1}}`
+	goLog := &logtypes.Log{
+		Timestamp: time.Unix(1525202600, 0),
+		Message:   "offset 2s",
+		Fields: map[string]string{
+			CheckField:       "ntp",
+			StatusField:      "1",
+			ClientField:      "node-2",
+			OccurrencesField: "0",
+			IntervalField:    "30",
+			RunbookField:     "https://runbooks/ntp",
+		},
+	}
+	testCases := []struct {
+		config map[string]string
+		input  string
+		err    bool
+		log    *logtypes.Log
+	}{
+		{
+			// check result
+			input: `{"timestamp":"2018-05-01T12:23:45.123456-0700","level":"info","message":"publishing check result",` +
+				`"payload":{"client":"node-1","check":{"name":"disk_usage","interval":60,"occurrences":3,"output":"CRITICAL: disk 95% used","status":2,` +
+				`"owner":"storage-team","contacts":["storage","oncall"],"runbook":"https://runbooks/disk"}}}`,
+			log: &logtypes.Log{
+				Timestamp: time.Date(2018, 5, 1, 12, 23, 45, 123456000, time.FixedZone("PDT", -7*3600)),
+				Message:   "CRITICAL: disk 95% used",
+				Fields: map[string]string{
+					CheckField:       "disk_usage",
+					StatusField:      "2",
+					ClientField:      "node-1",
+					OccurrencesField: "3",
+					IntervalField:    "60",
+					RunbookField:     "https://runbooks/disk",
+					OwnerField:       "storage-team",
+					ContactsField:    "storage,oncall",
+				},
+			},
+		},
+		{
+			// not a check result
+			input: `{"timestamp":"2018-05-01T12:23:45.123456-0700","level":"info","message":"connected to transport"}`,
+		},
+		{
+			// invalid timestamp
+			input: `{"timestamp":"2018-05-01 12:23:45","payload":{"check":{"name":"ntp","output":"OK","status":0}}}`,
+			err:   true,
+		},
+		{
+			// not json
+			input: `May  1 12:23:45 hostname sensu-client: started`,
+			err:   true,
+		},
+		{
+			// sensu go event detected automatically
+			input: goEvent,
+			log:   goLog,
+		},
+		{
+			// sensu go event with go format configured
+			config: map[string]string{"format": "go"},
+			input:  goEvent,
+			log:    goLog,
+		},
+		{
+			// sensu go event falls back to the event timestamp
+			config: map[string]string{"format": "go"},
+			input:  `{"timestamp":1525202625,"check":{"metadata":{"name":"ntp"},"status":0}}`,
+			log: &logtypes.Log{
+				Timestamp: time.Unix(1525202625, 0),
+				Fields: map[string]string{
+					CheckField:       "ntp",
+					StatusField:      "0",
+					ClientField:      "",
+					OccurrencesField: "0",
+					IntervalField:    "0",
+				},
+			},
+		},
+		{
+			// sensu go event without check
+			config: map[string]string{"format": "go"},
+			input:  `{"timestamp":1525202625,"entity":{"metadata":{"name":"node-2"}},"metrics":{}}`,
+		},
+		{
+			// sensu go event is not a sensu 1.x log
+			config: map[string]string{"format": "1.x", "timestampFormat": "2006-01-02T15:04:05.000000-0700"},
+			input:  goEvent,
+			err:    true,
+		},
+	}
+
+	for c, test := range testCases {
+		t.Logf("TestCase #%d: %#v", c+1, test)
+		config := test.config
+		if config == nil {
+			config = getTestPluginConfig()
+		}
+		trans := newTranslatorOrDie(config)
+		log, err := trans.Translate(test.input)
+		if test.err {
+			require.Error(t, err)
+		} else if test.log == nil {
+			// The lines without check result are skipped without error.
+			require.NoError(t, err)
+			assert.Nil(t, log)
+		} else {
+			require.NoError(t, err)
+			// Use RFC3339Nano to make it easier for comparison.
+			assert.Equal(t, test.log.Timestamp.Format(time.RFC3339Nano), log.Timestamp.Format(time.RFC3339Nano))
+			assert.Equal(t, test.log.Message, log.Message)
+			assert.Equal(t, test.log.Fields, log.Fields)
+		}
+	}
+}
+
+func TestValidatePluginConfig(t *testing.T) {
+	assert.NoError(t, validatePluginConfig(getTestPluginConfig()))
+	assert.NoError(t, validatePluginConfig(map[string]string{"format": "go"}))
+	assert.Error(t, validatePluginConfig(map[string]string{"format": "auto"}))
+	assert.Error(t, validatePluginConfig(map[string]string{"format": "2.x", "timestampFormat": "2006"}))
+}
@@ -0,0 +1,334 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	utilclock "code.cloudfoundry.org/clock"
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+const (
+	// addressKey is the key of the listen address in the plugin configuration,
+	// either "host:port" for tcp and udp, or the socket path for unix and
+	// unixgram.
+	addressKey = "address"
+	// protocolsKey is the key of the comma separated protocols to listen on in
+	// the plugin configuration. Supported protocols are tcp, udp, unix and
+	// unixgram. A unix protocol can't be combined with other protocols.
+	protocolsKey = "protocols"
+
+	// defaultAddress is the default address for tcp and udp.
+	defaultAddress = "127.0.0.1:514"
+	// defaultProtocols are the default protocols.
+	defaultProtocols = "udp"
+)
+
+// syslogWatcher receives the syslog messages in the RFC 5424 or RFC 3164
+// format over tcp, udp or unix sockets.
+type syslogWatcher struct {
+	cfg       types.WatcherConfig
+	address   string
+	protocols []string
+	listeners []net.Listener
+	conns     []net.PacketConn
+	logCh     chan *logtypes.Log
+	tomb      *tomb.Tomb
+	clock     utilclock.Clock
+	// mu protects streams and stopped.
+	mu sync.Mutex
+	// streams are the accepted stream connections, closed on stop.
+	streams map[net.Conn]bool
+	// stopped is set when the sockets are closed, so that the connections
+	// accepted afterwards are closed right away.
+	stopped bool
+	// wg waits for all the goroutines sending logs.
+	wg sync.WaitGroup
+}
+
+// NewSyslogWatcherOrDie creates a new syslog receiver. The function panics
+// when encounters an error.
+func NewSyslogWatcherOrDie(cfg types.WatcherConfig) types.LogWatcher {
+	protocols := cfg.PluginConfig[protocolsKey]
+	if protocols == "" {
+		protocols = defaultProtocols
+	}
+	w := &syslogWatcher{
+		cfg:     cfg,
+		address: cfg.PluginConfig[addressKey],
+		tomb:    tomb.NewTomb(),
+		// A capacity 1000 buffer should be enough
+		logCh:   make(chan *logtypes.Log, 1000),
+		clock:   utilclock.NewClock(),
+		streams: map[net.Conn]bool{},
+	}
+	unix := false
+	for _, protocol := range strings.Split(protocols, ",") {
+		protocol = strings.TrimSpace(protocol)
+		switch protocol {
+		case "tcp", "udp":
+		case "unix", "unixgram":
+			unix = true
+		default:
+			glog.Fatalf("Unsupported syslog protocol %q", protocol)
+		}
+		w.protocols = append(w.protocols, protocol)
+	}
+	if unix && len(w.protocols) > 1 {
+		glog.Fatalf("Syslog protocols %q can't share the same address", protocols)
+	}
+	if w.address == "" {
+		if unix {
+			glog.Fatalf("Syslog address is required for protocol %q", protocols)
+		}
+		w.address = defaultAddress
+	}
+	return w
+}
+
+// Make sure NewSyslogWatcherOrDie is types.WatcherCreateFunc.
+var _ types.WatcherCreateFunc = NewSyslogWatcherOrDie
+
+// Watch starts listening on the syslog sockets.
+func (w *syslogWatcher) Watch() (<-chan *logtypes.Log, error) {
+	for _, protocol := range w.protocols {
+		var err error
+		if protocol == "unix" || protocol == "unixgram" {
+			if err = removeStaleSocket(w.address); err != nil {
+				return nil, err
+			}
+		}
+		switch protocol {
+		case "tcp", "unix":
+			var l net.Listener
+			if l, err = net.Listen(protocol, w.address); err == nil {
+				w.listeners = append(w.listeners, l)
+			}
+		case "udp", "unixgram":
+			var c net.PacketConn
+			if c, err = net.ListenPacket(protocol, w.address); err == nil {
+				w.conns = append(w.conns, c)
+			}
+		}
+		if err != nil {
+			w.closeSockets()
+			return nil, fmt.Errorf("failed to listen on %s %q: %v", protocol, w.address, err)
+		}
+	}
+	glog.Infof("Start receiving syslog messages on %s %q", strings.Join(w.protocols, ","), w.address)
+	for _, l := range w.listeners {
+		w.wg.Add(1)
+		go w.acceptLoop(l)
+	}
+	for _, c := range w.conns {
+		w.wg.Add(1)
+		go w.readLoop(c)
+	}
+	go w.watchLoop()
+	return w.logCh, nil
+}
+
+// Stop stops the syslog receiver.
+func (w *syslogWatcher) Stop() {
+	w.tomb.Stop()
+}
+
+// watchLoop waits for the watcher to stop and cleans up.
+func (w *syslogWatcher) watchLoop() {
+	defer func() {
+		close(w.logCh)
+		w.tomb.Done()
+	}()
+	<-w.tomb.Stopping()
+	glog.Infof("Stop receiving syslog messages")
+	w.closeSockets()
+	w.wg.Wait()
+}
+
+func (w *syslogWatcher) closeSockets() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stopped = true
+	for _, l := range w.listeners {
+		l.Close()
+	}
+	for _, c := range w.conns {
+		c.Close()
+		// Unlike the unix listener, the unixgram socket isn't removed on close.
+		if c.LocalAddr().Network() == "unixgram" {
+			os.Remove(w.address)
+		}
+	}
+	for conn := range w.streams {
+		conn.Close()
+	}
+}
+
+// removeStaleSocket removes the socket left by the last run, which fails the
+// listening. Files other than sockets are left untouched.
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return nil
+	}
+	if err := os.Remove(path); err != nil {
+		return fmt.Errorf("failed to remove stale socket %q: %v", path, err)
+	}
+	return nil
+}
+
+// acceptLoop accepts the stream connections until the listener is closed.
+func (w *syslogWatcher) acceptLoop(l net.Listener) {
+	defer w.wg.Done()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			select {
+			case <-w.tomb.Stopping():
+			default:
+				glog.Errorf("Exiting syslog accept loop with error: %v", err)
+			}
+			return
+		}
+		w.mu.Lock()
+		if w.stopped {
+			conn.Close()
+		} else {
+			w.streams[conn] = true
+			w.wg.Add(1)
+			go w.handleConn(conn)
+		}
+		w.mu.Unlock()
+	}
+}
+
+// handleConn reads the syslog messages from the stream connection until it is
+// closed.
+func (w *syslogWatcher) handleConn(conn net.Conn) {
+	defer w.wg.Done()
+	defer func() {
+		w.mu.Lock()
+		delete(w.streams, conn)
+		w.mu.Unlock()
+		conn.Close()
+	}()
+	r := bufio.NewReader(conn)
+	for {
+		data, err := readFrame(r)
+		if err != nil {
+			if err != io.EOF {
+				select {
+				case <-w.tomb.Stopping():
+				default:
+					glog.Warningf("Failed to read syslog message from %v: %v", conn.RemoteAddr(), err)
+				}
+			}
+			return
+		}
+		w.send(data)
+	}
+}
+
+// maxMessageSize is the max size of a syslog message, which is also the max
+// size of a udp datagram.
+const maxMessageSize = 65535
+
+// readFrame reads a syslog message from the stream with the octet counting or
+// the non-transparent framing of RFC 6587, i.e. "MSG-LEN SP SYSLOG-MSG" or the
+// message terminated by a newline. The messages sent to a unix stream socket
+// by glibc are terminated by NUL instead.
+func readFrame(r *bufio.Reader) (string, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if b[0] >= '1' && b[0] <= '9' {
+		prefix, err := r.ReadString(' ')
+		if err != nil {
+			return "", fmt.Errorf("failed to read message length: %v", err)
+		}
+		length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+		if err != nil || length > maxMessageSize {
+			return "", fmt.Errorf("invalid message length %q", prefix)
+		}
+		data := make([]byte, length)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return "", fmt.Errorf("failed to read message of length %d: %v", length, err)
+		}
+		return string(data), nil
+	}
+	var data []byte
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF && len(data) > 0 {
+			return string(data), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if c == '\n' || c == 0 {
+			return string(data), nil
+		}
+		if len(data) >= maxMessageSize {
+			return "", fmt.Errorf("message longer than %d bytes", maxMessageSize)
+		}
+		data = append(data, c)
+	}
+}
+
+// readLoop reads the syslog messages from the datagram socket until it is
+// closed. Each datagram is a syslog message.
+func (w *syslogWatcher) readLoop(c net.PacketConn) {
+	defer w.wg.Done()
+	buf := make([]byte, maxMessageSize)
+	for {
+		n, _, err := c.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-w.tomb.Stopping():
+			default:
+				glog.Errorf("Exiting syslog read loop with error: %v", err)
+			}
+			return
+		}
+		w.send(string(buf[:n]))
+	}
+}
+
+// send parses the syslog message and sends it to the log channel. Empty
+// messages, e.g. keepalive newlines, are dropped.
+func (w *syslogWatcher) send(data string) {
+	if strings.TrimSpace(data) == "" {
+		return
+	}
+	select {
+	case w.logCh <- parseMessage(data, w.clock.Now()):
+	case <-w.tomb.Stopping():
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func newTestWatcher(t *testing.T, protocols, address string) (*syslogWatcher, <-chan *logtypes.Log, string) {
+	w := NewSyslogWatcherOrDie(types.WatcherConfig{
+		Plugin: "syslog",
+		PluginConfig: map[string]string{
+			"address":   address,
+			"protocols": protocols,
+		},
+	}).(*syslogWatcher)
+	logCh, err := w.Watch()
+	require.NoError(t, err)
+	if len(w.listeners) > 0 {
+		return w, logCh, w.listeners[0].Addr().String()
+	}
+	return w, logCh, w.conns[0].LocalAddr().String()
+}
+
+func receiveLog(t *testing.T, logCh <-chan *logtypes.Log) *logtypes.Log {
+	select {
+	case log := <-logCh:
+		return log
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for log")
+	}
+	return nil
+}
+
+func TestWatchDatagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for protocol, address := range map[string]string{
+		"udp":      "127.0.0.1:0",
+		"unixgram": filepath.Join(dir, "dgram.sock"),
+	} {
+		w, logCh, address := newTestWatcher(t, protocol, address)
+		conn, err := net.Dial(protocol, address)
+		require.NoError(t, err)
+		_, err = conn.Write([]byte("<11>kubelet[42]: Failed to start container\n"))
+		require.NoError(t, err)
+		log := receiveLog(t, logCh)
+		assert.Equal(t, "Failed to start container", log.Message, protocol)
+		assert.Equal(t, "kubelet", log.Fields[IdentifierField], protocol)
+		assert.Equal(t, "3", log.Fields[PriorityField], protocol)
+		conn.Close()
+		w.Stop()
+	}
+	// The unixgram socket is removed on stop.
+	_, err = os.Stat(filepath.Join(dir, "dgram.sock"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWatchStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	for protocol, address := range map[string]string{
+		"tcp":  "127.0.0.1:0",
+		"unix": filepath.Join(dir, "stream.sock"),
+	} {
+		w, logCh, address := newTestWatcher(t, protocol, address)
+		conn, err := net.Dial(protocol, address)
+		require.NoError(t, err)
+		// Newline, octet counting and NUL framing on the same connection.
+		msg := `<34>1 2018-01-02T03:04:00Z node-1 appliance - - [origin ip="192.0.2.1"] disk failed`
+		_, err = conn.Write([]byte("<11>kubelet: first\n" + strconv.Itoa(len(msg)) + " " + msg + "<13>glibc: third\x00"))
+		require.NoError(t, err)
+		assert.Equal(t, "first", receiveLog(t, logCh).Message, protocol)
+		log := receiveLog(t, logCh)
+		assert.Equal(t, "disk failed", log.Message, protocol)
+		assert.Equal(t, "192.0.2.1", log.Fields["origin.ip"], protocol)
+		assert.Equal(t, "third", receiveLog(t, logCh).Message, protocol)
+		// Stop closes the open connection.
+		w.Stop()
+		_, err = bufio.NewReader(conn).ReadByte()
+		assert.Error(t, err, protocol)
+		conn.Close()
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("5 hello\n\nunterminated"))
+	for _, expected := range []string{"hello", "", "", "unterminated"} {
+		data, err := readFrame(r)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, data)
+	}
+	_, err := readFrame(r)
+	assert.Error(t, err)
+
+	_, err = readFrame(bufio.NewReader(strings.NewReader("99999999 too long")))
+	assert.Error(t, err)
+}
+
+func TestRemoveStaleSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "syslog_test")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "syslog.sock")
+
+	// A stale socket left by the last run doesn't fail the listening.
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	require.NoError(t, err)
+	l.SetUnlinkOnClose(false)
+	l.Close()
+	w, _, _ := newTestWatcher(t, "unix", path)
+	w.Stop()
+
+	// Other files are not removed.
+	require.NoError(t, ioutil.WriteFile(path, []byte("not a socket"), 0644))
+	_, err = NewSyslogWatcherOrDie(types.WatcherConfig{
+		PluginConfig: map[string]string{"address": path, "protocols": "unix"},
+	}).Watch()
+	assert.Error(t, err)
+}
+
+func TestStop(t *testing.T) {
+	original := runtime.NumGoroutine()
+	w, logCh, _ := newTestWatcher(t, "tcp,udp", "127.0.0.1:0")
+	w.Stop()
+	select {
+	case _, ok := <-logCh:
+		assert.False(t, ok, "log channel should be closed")
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timeout waiting for watcher to stop")
+	}
+	assert.Equal(t, original, runtime.NumGoroutine())
+}
@@ -0,0 +1,271 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+const (
+	// PriorityField is the field of the log level of the syslog message, from
+	// 0 (emerg) to 7 (debug). The fields are named after the journal fields,
+	// so that rules on them work for both syslog messages and journal logs.
+	PriorityField = "PRIORITY"
+	// FacilityField is the field of the syslog facility of the message.
+	FacilityField = "SYSLOG_FACILITY"
+	// IdentifierField is the field of the app name of RFC 5424, or the tag of
+	// RFC 3164, e.g. "kubelet".
+	IdentifierField = "SYSLOG_IDENTIFIER"
+	// PIDField is the field of the process id of the sender.
+	PIDField = "SYSLOG_PID"
+	// MessageIDField is the field of the message id of RFC 5424.
+	MessageIDField = "SYSLOG_MSGID"
+	// HostnameField is the field of the hostname of the sender.
+	HostnameField = "HOSTNAME"
+)
+
+const (
+	// defaultPriority is the priority of the messages without a valid PRI, i.e.
+	// user.notice, as RFC 3164 section 4.3.3.
+	defaultPriority = 13
+	// maxPriority is the max valid PRI, i.e. local7.debug.
+	maxPriority = 191
+	// rfc5424Version is the version of RFC 5424 following PRI.
+	rfc5424Version = "1 "
+	// nilValue is the value of the missing header fields of RFC 5424.
+	nilValue = "-"
+	// bom is the UTF-8 byte order mark which may start the message of RFC 5424.
+	bom = "\xef\xbb\xbf"
+	// rfc3164Timestamp is the format of the timestamp of RFC 3164, without year.
+	rfc3164Timestamp = time.Stamp
+)
+
+// parseMessage parses a syslog message in the RFC 5424 or RFC 3164 format into
+// a log. The structured data elements of RFC 5424 are exposed as the fields
+// named "SD-ID.PARAM-NAME", e.g. "origin.ip". The parser is lenient as RFC 3164
+// section 4.3.3: the header fields which can't be parsed are left to the
+// message, and the time the message is received is used when the message has
+// no valid timestamp.
+func parseMessage(data string, now time.Time) *logtypes.Log {
+	data = strings.TrimRight(data, "\r\n\x00")
+	priority, rest, ok := parsePriority(data)
+	if !ok {
+		priority, rest = defaultPriority, data
+	}
+	timestamp, fields, message, err := parseRFC5424(rest, now)
+	if err != nil {
+		glog.V(5).Infof("Parsing syslog message %q in RFC 3164 format: %v", data, err)
+		timestamp, fields, message = parseRFC3164(rest, now)
+	}
+	log := &logtypes.Log{
+		Timestamp: timestamp,
+		Message:   message,
+		Fields:    fields,
+	}
+	log.Fields[PriorityField] = strconv.Itoa(priority & 7)
+	log.Fields[FacilityField] = strconv.Itoa(priority >> 3)
+	return log
+}
+
+// parsePriority parses the PRI part of the message, e.g. "<34>". It returns
+// the priority and the rest of the message.
+func parsePriority(data string) (int, string, bool) {
+	if !strings.HasPrefix(data, "<") {
+		return 0, data, false
+	}
+	i := strings.IndexByte(data, '>')
+	// PRI has 1 to 3 digits.
+	if i < 2 || i > 4 {
+		return 0, data, false
+	}
+	priority, err := strconv.Atoi(data[1:i])
+	if err != nil || priority < 0 || priority > maxPriority {
+		return 0, data, false
+	}
+	return priority, data[i+1:], true
+}
+
+// parseRFC5424 parses the message after "<PRI>" in the RFC 5424 format:
+// "1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]".
+func parseRFC5424(data string, now time.Time) (time.Time, map[string]string, string, error) {
+	if !strings.HasPrefix(data, rfc5424Version) {
+		return now, nil, "", fmt.Errorf("not in RFC 5424 format")
+	}
+	data = data[len(rfc5424Version):]
+	timestamp := now
+	fields := map[string]string{}
+	headers := []string{"", HostnameField, IdentifierField, PIDField, MessageIDField}
+	for i, name := range headers {
+		j := strings.IndexByte(data, ' ')
+		if j <= 0 {
+			return now, nil, "", fmt.Errorf("incomplete header %q", data)
+		}
+		value := data[:j]
+		data = data[j+1:]
+		if value == nilValue {
+			continue
+		}
+		if i == 0 {
+			t, err := time.Parse(time.RFC3339Nano, value)
+			if err != nil {
+				return now, nil, "", fmt.Errorf("invalid timestamp %q: %v", value, err)
+			}
+			timestamp = t
+			continue
+		}
+		fields[name] = value
+	}
+	data, err := parseStructuredData(data, fields)
+	if err != nil {
+		return now, nil, "", err
+	}
+	if data != "" && !strings.HasPrefix(data, " ") {
+		return now, nil, "", fmt.Errorf("unexpected %q after structured data", data)
+	}
+	message := strings.TrimPrefix(strings.TrimPrefix(data, " "), bom)
+	return timestamp, fields, message, nil
+}
+
+// parseStructuredData parses the structured data of RFC 5424 into the fields,
+// e.g. `[origin ip="192.0.2.1"][meta sequenceId="1"]`. It returns the rest of
+// the message.
+func parseStructuredData(data string, fields map[string]string) (string, error) {
+	if strings.HasPrefix(data, nilValue) {
+		return data[len(nilValue):], nil
+	}
+	if !strings.HasPrefix(data, "[") {
+		return "", fmt.Errorf("invalid structured data %q", data)
+	}
+	for strings.HasPrefix(data, "[") {
+		i := strings.IndexAny(data, " ]")
+		if i <= 1 {
+			return "", fmt.Errorf("invalid structured data element %q", data)
+		}
+		id := data[1:i]
+		data = data[i:]
+		for strings.HasPrefix(data, " ") {
+			j := strings.Index(data, `="`)
+			if j <= 1 {
+				return "", fmt.Errorf("invalid structured data parameter %q", data)
+			}
+			name := data[1:j]
+			value, rest, err := parseParamValue(data[j+2:])
+			if err != nil {
+				return "", err
+			}
+			fields[id+"."+name] = value
+			data = rest
+		}
+		if !strings.HasPrefix(data, "]") {
+			return "", fmt.Errorf("unterminated structured data element %q", id)
+		}
+		data = data[1:]
+	}
+	return data, nil
+}
+
+// parseParamValue parses the parameter value after the opening quote, in which
+// '"', '\' and ']' are escaped with '\'. It returns the value and the rest of
+// the message after the closing quote.
+func parseParamValue(data string) (string, string, error) {
+	var value []byte
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			if i+1 < len(data) && strings.IndexByte(`"\]`, data[i+1]) >= 0 {
+				i++
+			}
+		case '"':
+			return string(value), data[i+1:], nil
+		}
+		value = append(value, data[i])
+	}
+	return "", "", fmt.Errorf("unterminated parameter value %q", data)
+}
+
+// parseRFC3164 parses the message after "<PRI>" in the RFC 3164 format:
+// "TIMESTAMP HOSTNAME TAG[PID]: MSG". The local senders usually omit the
+// hostname, and some senders use a RFC 3339 timestamp instead.
+func parseRFC3164(data string, now time.Time) (time.Time, map[string]string, string) {
+	timestamp := now
+	fields := map[string]string{}
+	hasTimestamp := false
+	if len(data) > len(rfc3164Timestamp) && data[len(rfc3164Timestamp)] == ' ' {
+		if t, err := time.ParseInLocation(rfc3164Timestamp, data[:len(rfc3164Timestamp)], now.Location()); err == nil {
+			timestamp = withYear(t, now)
+			data = data[len(rfc3164Timestamp)+1:]
+			hasTimestamp = true
+		}
+	}
+	if i := strings.IndexByte(data, ' '); !hasTimestamp && i > 0 {
+		if t, err := time.Parse(time.RFC3339Nano, data[:i]); err == nil {
+			timestamp = t
+			data = data[i+1:]
+			hasTimestamp = true
+		}
+	}
+	// The hostname only follows the timestamp. A tag ends with ':' or contains
+	// the pid in brackets, which a hostname can't.
+	if i := strings.IndexByte(data, ' '); hasTimestamp && i > 0 && !strings.ContainsAny(data[:i], ":[") {
+		fields[HostnameField] = data[:i]
+		data = data[i+1:]
+	}
+	if tag, pid, rest, ok := parseTag(data); ok {
+		fields[IdentifierField] = tag
+		if pid != "" {
+			fields[PIDField] = pid
+		}
+		data = rest
+	}
+	return timestamp, fields, data
+}
+
+// parseTag parses the tag of RFC 3164, e.g. "kubelet[1234]: " or "kernel: ".
+// It returns the tag, the pid and the rest of the message.
+func parseTag(data string) (string, string, string, bool) {
+	i := strings.IndexAny(data, "[: ")
+	if i <= 0 || data[i] == ' ' {
+		return "", "", data, false
+	}
+	tag, pid, rest := data[:i], "", data[i+1:]
+	if data[i] == '[' {
+		j := strings.Index(rest, "]:")
+		if j <= 0 {
+			return "", "", data, false
+		}
+		pid, rest = rest[:j], rest[j+2:]
+	}
+	return tag, pid, strings.TrimPrefix(rest, " "), true
+}
+
+// withYear sets the year of the RFC 3164 timestamp, which has no year. The
+// timestamp is in the last year if it would be more than a day in the future,
+// e.g. a message of Dec 31 received on Jan 1.
+func withYear(t, now time.Time) time.Time {
+	t = time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, now.Location())
+	if t.After(now.Add(24 * time.Hour)) {
+		t = t.AddDate(-1, 0, 0)
+	}
+	return t
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package syslog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+func TestParseMessage(t *testing.T) {
+	now := time.Date(2018, time.January, 2, 3, 4, 5, 0, time.UTC)
+	for desc, test := range map[string]struct {
+		data     string
+		expected *logtypes.Log
+	}{
+		"rfc 5424": {
+			data: `<34>1 2018-01-02T03:04:00.123Z node-1 kubelet 1234 ID47 - Failed to start container` + "\n",
+			expected: &logtypes.Log{
+				Timestamp: time.Date(2018, time.January, 2, 3, 4, 0, 123000000, time.UTC),
+				Message:   "Failed to start container",
+				Fields: map[string]string{
+					PriorityField:   "2",
+					FacilityField:   "4",
+					HostnameField:   "node-1",
+					IdentifierField: "kubelet",
+					PIDField:        "1234",
+					MessageIDField:  "ID47",
+				},
+			},
+		},
+		"rfc 5424 with structured data": {
+			data: `<165>1 2018-01-02T03:04:00Z - appliance - - [origin ip="192.0.2.1"][meta sequenceId="1" note="a \"quoted\" \] value"] ` + bom + "disk failed",
+			expected: &logtypes.Log{
+				Timestamp: time.Date(2018, time.January, 2, 3, 4, 0, 0, time.UTC),
+				Message:   "disk failed",
+				Fields: map[string]string{
+					PriorityField:     "5",
+					FacilityField:     "20",
+					IdentifierField:   "appliance",
+					"origin.ip":       "192.0.2.1",
+					"meta.sequenceId": "1",
+					"meta.note":       `a "quoted" ] value`,
+				},
+			},
+		},
+		"rfc 5424 without timestamp and message": {
+			data: `<14>1 - - - - - -`,
+			expected: &logtypes.Log{
+				Timestamp: now,
+				Fields:    map[string]string{PriorityField: "6", FacilityField: "1"},
+			},
+		},
+		"rfc 3164": {
+			data: "<13>Jan  2 03:00:00 node-1 kubelet[1234]: Failed to start container",
+			expected: &logtypes.Log{
+				Timestamp: time.Date(2018, time.January, 2, 3, 0, 0, 0, time.UTC),
+				Message:   "Failed to start container",
+				Fields: map[string]string{
+					PriorityField:   "5",
+					FacilityField:   "1",
+					HostnameField:   "node-1",
+					IdentifierField: "kubelet",
+					PIDField:        "1234",
+				},
+			},
+		},
+		"rfc 3164 from last year": {
+			data: "<0>Dec 31 23:59:59 kernel: Oops",
+			expected: &logtypes.Log{
+				Timestamp: time.Date(2017, time.December, 31, 23, 59, 59, 0, time.UTC),
+				Message:   "Oops",
+				Fields:    map[string]string{PriorityField: "0", FacilityField: "0", IdentifierField: "kernel"},
+			},
+		},
+		"rfc 3164 with rfc 3339 timestamp": {
+			data: "<30>2018-01-02T03:04:00Z node-1 containerd: pulling image",
+			expected: &logtypes.Log{
+				Timestamp: time.Date(2018, time.January, 2, 3, 4, 0, 0, time.UTC),
+				Message:   "pulling image",
+				Fields: map[string]string{
+					PriorityField:   "6",
+					FacilityField:   "3",
+					HostnameField:   "node-1",
+					IdentifierField: "containerd",
+				},
+			},
+		},
+		"rfc 3164 without timestamp": {
+			data: "<11>myapp: failed",
+			expected: &logtypes.Log{
+				Timestamp: now,
+				Message:   "failed",
+				Fields:    map[string]string{PriorityField: "3", FacilityField: "1", IdentifierField: "myapp"},
+			},
+		},
+		"invalid rfc 5424 falls back to rfc 3164": {
+			data: `<14>1 2018-01-02T03:04:00Z node-1 app - - [unterminated message`,
+			expected: &logtypes.Log{
+				Timestamp: now,
+				Message:   `1 2018-01-02T03:04:00Z node-1 app - - [unterminated message`,
+				Fields:    map[string]string{PriorityField: "6", FacilityField: "1"},
+			},
+		},
+		"missing priority": {
+			data: "plain message",
+			expected: &logtypes.Log{
+				Timestamp: now,
+				Message:   "plain message",
+				Fields:    map[string]string{PriorityField: "5", FacilityField: "1"},
+			},
+		},
+		"invalid priority": {
+			data: "<192>message",
+			expected: &logtypes.Log{
+				Timestamp: now,
+				Message:   "<192>message",
+				Fields:    map[string]string{PriorityField: "5", FacilityField: "1"},
+			},
+		},
+	} {
+		assert.Equal(t, test.expected, parseMessage(test.data, now), desc)
+	}
+}
@@ -0,0 +1,255 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package tail implements a rotation aware "tail -F" reader for the file based
+// log watchers.
+package tail
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+
+	utilclock "code.cloudfoundry.org/clock"
+	"github.com/golang/glog"
+)
+
+const (
+	// defaultRetryInterval is the initial interval to retry opening a missing file.
+	defaultRetryInterval = 500 * time.Millisecond
+	// maxRetryInterval is the max interval to retry opening a missing file.
+	maxRetryInterval = 30 * time.Second
+	// RotatedSuffix is the suffix of the just rotated file, e.g. "kern.log.1".
+	RotatedSuffix = ".1"
+)
+
+// Tail reads a file and follows it across log rotation. The reader returns
+// io.EOF when it reaches the end of the file, and the caller should poll it
+// again later. It handles:
+// * Missing file: Retry opening the file with backoff until it shows up.
+// * Rename/create rotation: Switch to the new file after reading to the end of
+// the rotated file.
+// * Copytruncate rotation: Read from the head of the file again when the file
+// is truncated below the read offset.
+// Tail is not safe for concurrent use.
+type Tail struct {
+	path string
+	file *os.File
+	// info is the file info of the opened file.
+	info os.FileInfo
+	// offset is the read offset in the opened file.
+	offset int64
+	// generation is increased whenever the reader starts over from the head
+	// of a file, i.e. a file is opened or the opened file is truncated.
+	generation int
+	// readingRotated indicates that the opened file is the rotated file read
+	// for lookback.
+	readingRotated bool
+	// retryInterval is the current interval to retry opening the missing file.
+	retryInterval time.Duration
+	// nextOpen is the time to retry opening the missing file.
+	nextOpen time.Time
+	clock    utilclock.Clock
+}
+
+var _ io.ReadCloser = &Tail{}
+
+// NewTail creates a Tail of the file. If lookbackRotated is true, Tail reads
+// the just rotated file, e.g. "kern.log.1", before the file if it exists, so
+// that the logs written right before the rotation can be looked back.
+func NewTail(path string, lookbackRotated bool) (*Tail, error) {
+	return newTail(path, lookbackRotated, utilclock.NewClock())
+}
+
+// NewTailFrom creates a Tail of the file resuming from the offset in the file
+// with the inode. The file with the inode may be the file or the just rotated
+// file if the file was rotated in the meantime. It returns error if neither
+// file has the inode, or the file was truncated below the offset.
+func NewTailFrom(path string, ino uint64, offset int64) (*Tail, error) {
+	return newTailFrom(path, ino, offset, utilclock.NewClock())
+}
+
+func newTailFrom(path string, ino uint64, offset int64, clock utilclock.Clock) (*Tail, error) {
+	t, err := newTail(path, false, clock)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range []string{path, path + RotatedSuffix} {
+		f, err := os.Open(p)
+		if err != nil {
+			continue
+		}
+		info, err := f.Stat()
+		if err != nil || inode(info) != ino {
+			f.Close()
+			continue
+		}
+		if info.Size() < offset {
+			f.Close()
+			return nil, fmt.Errorf("file %q is truncated to %d bytes below offset %d", p, info.Size(), offset)
+		}
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to seek %q to offset %d: %v", p, offset, err)
+		}
+		t.setFile(f)
+		t.offset = offset
+		// Switch to the file after reading to the end of the rotated file.
+		t.readingRotated = p != path
+		return t, nil
+	}
+	return nil, fmt.Errorf("no file with inode %d found for %q", ino, path)
+}
+
+func newTail(path string, lookbackRotated bool, clock utilclock.Clock) (*Tail, error) {
+	if path == "" {
+		return nil, fmt.Errorf("unexpected empty log path")
+	}
+	t := &Tail{
+		path:          path,
+		retryInterval: defaultRetryInterval,
+		clock:         clock,
+	}
+	if lookbackRotated {
+		rotated := path + RotatedSuffix
+		if f, err := os.Open(rotated); err == nil {
+			glog.Infof("Look back the rotated file %q", rotated)
+			t.setFile(f)
+			t.readingRotated = true
+		}
+	}
+	return t, nil
+}
+
+// Read implements the io.Reader interface. It returns io.EOF when there is no
+// new content for now. Log rotation is followed when reaching the end of the
+// file, and the new file is read in the next read, so that a read never mixes
+// the content of different files.
+func (t *Tail) Read(p []byte) (int, error) {
+	if t.file == nil && !t.open() {
+		return 0, io.EOF
+	}
+	n, err := t.file.Read(p)
+	t.offset += int64(n)
+	if err == io.EOF && n == 0 {
+		t.followRotation()
+	}
+	return n, err
+}
+
+// Close closes the opened file.
+func (t *Tail) Close() error {
+	if t.file == nil {
+		return nil
+	}
+	err := t.file.Close()
+	t.file = nil
+	return err
+}
+
+// Position returns the inode and the read offset of the opened file. The inode
+// is 0 if no file is opened.
+func (t *Tail) Position() (uint64, int64) {
+	return inode(t.info), t.offset
+}
+
+// Generation returns the generation of the content read, which changes when
+// the reader switches to a new file or starts over from the head of the
+// truncated file. The content of different generations is not continuous.
+func (t *Tail) Generation() int {
+	return t.generation
+}
+
+// open opens the file if it's time to retry. It returns false if the file
+// is still missing.
+func (t *Tail) open() bool {
+	now := t.clock.Now()
+	if now.Before(t.nextOpen) {
+		return false
+	}
+	f, err := os.Open(t.path)
+	if err != nil {
+		glog.V(4).Infof("Failed to open %q, retry in %v: %v", t.path, t.retryInterval, err)
+		t.nextOpen = now.Add(t.retryInterval)
+		if t.retryInterval *= 2; t.retryInterval > maxRetryInterval {
+			t.retryInterval = maxRetryInterval
+		}
+		return false
+	}
+	glog.V(2).Infof("Start reading %q", t.path)
+	t.retryInterval = defaultRetryInterval
+	t.nextOpen = time.Time{}
+	t.setFile(f)
+	return true
+}
+
+// setFile sets the opened file and reads it from the head.
+func (t *Tail) setFile(f *os.File) {
+	t.file = f
+	t.offset = 0
+	t.generation++
+	t.info, _ = f.Stat()
+}
+
+// followRotation checks whether the file is rotated after reading to the end
+// of the opened file, and follows the rotation.
+func (t *Tail) followRotation() {
+	if t.readingRotated {
+		// Always switch to the file after looking back the rotated file.
+		glog.V(2).Infof("Finish looking back the rotated file of %q", t.path)
+		t.readingRotated = false
+		t.Close()
+		return
+	}
+	info, err := os.Stat(t.path)
+	if err != nil {
+		// The file is missing in the middle of rotation, keep reading the
+		// opened file until the new file is created.
+		glog.V(4).Infof("Failed to stat %q: %v", t.path, err)
+		return
+	}
+	if t.info != nil && !os.SameFile(t.info, info) {
+		// The file is renamed, and a new file is created.
+		glog.Infof("File %q is rotated, start reading the new file", t.path)
+		t.Close()
+		return
+	}
+	if info.Size() < t.offset {
+		// The file is truncated.
+		glog.Infof("File %q is truncated, start reading from the head", t.path)
+		if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+			glog.Errorf("Failed to seek %q to the head, reopen it: %v", t.path, err)
+			t.Close()
+			return
+		}
+		t.offset = 0
+		t.generation++
+		t.info = info
+	}
+}
+
+// inode returns the inode of the file, or 0 if the file info is nil.
+func inode(info os.FileInfo) uint64 {
+	if info == nil {
+		return 0
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok {
+		return stat.Ino
+	}
+	return 0
+}
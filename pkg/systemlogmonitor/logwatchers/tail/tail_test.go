@@ -0,0 +1,223 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package tail
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"code.cloudfoundry.org/clock/fakeclock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readToEnd reads the tail until io.EOF is returned twice in a row, because
+// log rotation is followed in the read after the first io.EOF.
+func readToEnd(t *testing.T, tail *Tail) string {
+	var content []byte
+	buf := make([]byte, 4)
+	eof := false
+	for {
+		n, err := tail.Read(buf)
+		content = append(content, buf[:n]...)
+		if err == io.EOF {
+			if eof {
+				return string(content)
+			}
+			eof = true
+			continue
+		}
+		require.NoError(t, err)
+		eof = false
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+}
+
+func appendFile(t *testing.T, path, content string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+}
+
+func newTestTail(t *testing.T, lookbackRotated bool) (*Tail, string, *fakeclock.FakeClock, func()) {
+	dir, err := ioutil.TempDir("", "tail_test")
+	require.NoError(t, err)
+	path := filepath.Join(dir, "kern.log")
+	fakeClock := fakeclock.NewFakeClock(time.Now())
+	if lookbackRotated {
+		writeFile(t, path+RotatedSuffix, "rotated 1\nrotated 2\n")
+	}
+	tail, err := newTail(path, lookbackRotated, fakeClock)
+	require.NoError(t, err)
+	return tail, path, fakeClock, func() {
+		tail.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestEmptyPath(t *testing.T) {
+	_, err := NewTail("", false)
+	assert.Error(t, err)
+}
+
+func TestMissingFile(t *testing.T) {
+	tail, path, fakeClock, cleanup := newTestTail(t, false)
+	defer cleanup()
+
+	assert.Equal(t, "", readToEnd(t, tail))
+	writeFile(t, path, "line 1\n")
+	// The file should not be reopened before the retry interval.
+	assert.Equal(t, "", readToEnd(t, tail))
+	fakeClock.Increment(defaultRetryInterval)
+	assert.Equal(t, "line 1\n", readToEnd(t, tail))
+	appendFile(t, path, "line 2\n")
+	assert.Equal(t, "line 2\n", readToEnd(t, tail))
+}
+
+func TestRetryBackoff(t *testing.T) {
+	tail, _, fakeClock, cleanup := newTestTail(t, false)
+	defer cleanup()
+
+	expected := defaultRetryInterval
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, "", readToEnd(t, tail))
+		assert.Equal(t, fakeClock.Now().Add(expected), tail.nextOpen)
+		fakeClock.Increment(expected)
+		if expected *= 2; expected > maxRetryInterval {
+			expected = maxRetryInterval
+		}
+	}
+}
+
+func TestCopyTruncate(t *testing.T) {
+	tail, path, _, cleanup := newTestTail(t, false)
+	defer cleanup()
+
+	writeFile(t, path, "line 1\nline 2\n")
+	assert.Equal(t, "line 1\nline 2\n", readToEnd(t, tail))
+	ino, _ := tail.Position()
+	assert.NotZero(t, ino)
+	generation := tail.Generation()
+	// Truncate the file in place and write less content.
+	writeFile(t, path, "line 3\n")
+	assert.Equal(t, "line 3\n", readToEnd(t, tail))
+	assert.NotEqual(t, generation, tail.Generation())
+	newIno, offset := tail.Position()
+	assert.Equal(t, ino, newIno)
+	assert.EqualValues(t, len("line 3\n"), offset)
+}
+
+func TestRenameCreate(t *testing.T) {
+	tail, path, fakeClock, cleanup := newTestTail(t, false)
+	defer cleanup()
+
+	writeFile(t, path, "line 1\n")
+	assert.Equal(t, "line 1\n", readToEnd(t, tail))
+	// Logs written to the rotated file before the new file is created should
+	// be read.
+	require.NoError(t, os.Rename(path, path+RotatedSuffix))
+	appendFile(t, path+RotatedSuffix, "line 2\n")
+	assert.Equal(t, "line 2\n", readToEnd(t, tail))
+	generation := tail.Generation()
+	writeFile(t, path, "line 3 in the new file\n")
+	fakeClock.Increment(defaultRetryInterval)
+	assert.Equal(t, "line 3 in the new file\n", readToEnd(t, tail))
+	assert.NotEqual(t, generation, tail.Generation())
+	appendFile(t, path, "line 4\n")
+	assert.Equal(t, "line 4\n", readToEnd(t, tail))
+}
+
+func TestLookbackRotated(t *testing.T) {
+	for desc, test := range map[string]struct {
+		lookbackRotated bool
+		expected        string
+	}{
+		"lookback rotated file": {
+			lookbackRotated: true,
+			expected:        "rotated 1\nrotated 2\nline 1\n",
+		},
+		"not lookback rotated file": {
+			lookbackRotated: false,
+			expected:        "line 1\n",
+		},
+	} {
+		tail, path, _, cleanup := newTestTail(t, test.lookbackRotated)
+		writeFile(t, path, "line 1\n")
+		assert.Equal(t, test.expected, readToEnd(t, tail), desc)
+		cleanup()
+	}
+}
+
+func TestNewTailFrom(t *testing.T) {
+	for desc, test := range map[string]struct {
+		// rotate rotates the file after the position is taken.
+		rotate   func(t *testing.T, path string)
+		offset   int64
+		expected string
+		isErr    bool
+	}{
+		"resume in the file": {
+			rotate:   func(t *testing.T, path string) { appendFile(t, path, "line 3\n") },
+			offset:   int64(len("line 1\n")),
+			expected: "line 2\nline 3\n",
+		},
+		"resume in the rotated file": {
+			rotate: func(t *testing.T, path string) {
+				require.NoError(t, os.Rename(path, path+RotatedSuffix))
+				writeFile(t, path, "line 3\n")
+			},
+			offset:   int64(len("line 1\n")),
+			expected: "line 2\nline 3\n",
+		},
+		"file truncated below the offset": {
+			rotate: func(t *testing.T, path string) { writeFile(t, path, "line\n") },
+			offset: int64(len("line 1\n")),
+			isErr:  true,
+		},
+		"file not found": {
+			rotate: func(t *testing.T, path string) {
+				require.NoError(t, os.Rename(path, path+".2"))
+				writeFile(t, path, "line 3\n")
+			},
+			isErr: true,
+		},
+	} {
+		_, path, fakeClock, cleanup := newTestTail(t, false)
+		writeFile(t, path, "line 1\nline 2\n")
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		test.rotate(t, path)
+		tail, err := newTailFrom(path, inode(info), test.offset, fakeClock)
+		if test.isErr {
+			assert.Error(t, err, desc)
+		} else {
+			assert.NoError(t, err, desc)
+			assert.Equal(t, test.expected, readToEnd(t, tail), desc)
+			tail.Close()
+		}
+		cleanup()
+	}
+}
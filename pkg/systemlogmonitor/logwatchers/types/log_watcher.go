@@ -28,23 +28,17 @@ type LogWatcher interface {
 	Stop()
 }
 
-// SensuLogWatcher is the interface of a log watcher.
-type SensuLogWatcher interface {
-	// Watch starts watching logs and returns logs via a channel.
-	Watch() (<-chan *types.SensuLog, error)
-	// Stop stops the log watcher. Resources open should be closed properly.
-	Stop()
-}
-
 // WatcherConfig is the configuration of the log watcher.
 type WatcherConfig struct {
 	// Plugin is the name of plugin which is currently used.
-	// Currently supported: filelog, journald, kmsg.
+	// Currently supported: filelog, containerlog, journald, kmsg, sensulog,
+	// sensusocket, syslog.
 	Plugin string `json:"plugin,omitempty"`
 	// PluginConfig is a key/value configuration of a plugin. Valid configurations
 	// are defined in different log watcher plugin.
 	PluginConfig map[string]string `json:"pluginConfig,omitempty"`
-	// LogPath is the path to the log
+	// LogPath is the path to the log. The filelog log watcher also accepts a
+	// glob pattern matching multiple log files.
 	LogPath string `json:"logPath,omitempty"`
 	// Lookback is the time log watcher looks up
 	Lookback string `json:"lookback,omitempty"`
@@ -52,9 +46,13 @@ type WatcherConfig struct {
 	// useful when the log watcher needs to wait for some time until the node
 	// becomes stable.
 	Delay string `json:"delay,omitempty"`
+	// Checkpoint is the path of the file the log watcher persists its read
+	// position in, so that it resumes where it left off after restart instead
+	// of looking back. The log watcher falls back to look back when the
+	// checkpoint is missing or invalid. Supported by the file based log
+	// watchers and the journald log watcher.
+	Checkpoint string `json:"checkpoint,omitempty"`
 }
 
 // WatcherCreateFunc is the create function of a log watcher.
 type WatcherCreateFunc func(WatcherConfig) LogWatcher
-
-type SensuWatcherCreateFunc func(WatcherConfig) SensuLogWatcher
@@ -0,0 +1,74 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"encoding/json"
+	"io/ioutil"
+
+	"github.com/golang/glog"
+
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// MonitorCreateFunc is the create function of a system log monitor. It takes
+// the path of the monitor configuration file.
+type MonitorCreateFunc func(configPath string) types.Monitor
+
+// createFuncs is a table of createFuncs for all supported system log monitors,
+// keyed by the log watcher plugin in the monitor configuration.
+var createFuncs = map[string]MonitorCreateFunc{}
+
+// RegisterMonitor registers a createFunc for the system log monitor of a log
+// watcher plugin. It should be called in init() of the package providing the
+// monitor. Registering the same plugin twice overrides the previous one.
+func RegisterMonitor(plugin string, create MonitorCreateFunc) {
+	createFuncs[plugin] = create
+}
+
+func init() {
+	// The regular expression rule based log monitor works for all the log
+	// watchers producing plain log lines.
+	for _, plugin := range []string{"filelog", "containerlog", "journald", "kmsg", "syslog"} {
+		RegisterMonitor(plugin, NewLogMonitorOrDie)
+	}
+	// The sensu log monitor works for the log watchers producing sensu check results.
+	for _, plugin := range []string{"sensulog", "sensusocket"} {
+		RegisterMonitor(plugin, NewSensuLogMonitorOrDie)
+	}
+}
+
+// NewMonitorOrDie creates a system log monitor based on the log watcher plugin
+// in the configuration file. The function panics when encounters an error.
+func NewMonitorOrDie(configPath string) types.Monitor {
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	var cfg watchertypes.WatcherConfig
+	err = json.Unmarshal(f, &cfg)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+	create, ok := createFuncs[cfg.Plugin]
+	if !ok {
+		glog.Fatalf("No monitor create function found for plugin %q in %q", cfg.Plugin, configPath)
+	}
+	glog.Infof("Use system log monitor of plugin %q for %q", cfg.Plugin, configPath)
+	return create(configPath)
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+type fakeMonitor struct {
+	configPath string
+}
+
+func (f *fakeMonitor) Start() (<-chan *types.Status, error) { return nil, nil }
+func (f *fakeMonitor) Stop()                                {}
+
+func TestNewMonitorOrDie(t *testing.T) {
+	RegisterMonitor("fake", func(configPath string) types.Monitor {
+		return &fakeMonitor{configPath: configPath}
+	})
+	defer delete(createFuncs, "fake")
+
+	f, err := ioutil.TempFile("", "monitor_config_test")
+	assert.NoError(t, err)
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+	}()
+	_, err = f.Write([]byte(`{"plugin": "fake", "source": "fake-monitor"}`))
+	assert.NoError(t, err)
+
+	m := NewMonitorOrDie(f.Name())
+	assert.Equal(t, &fakeMonitor{configPath: f.Name()}, m)
+}
+
+func TestBuiltinMonitorsRegistered(t *testing.T) {
+	for _, plugin := range []string{"filelog", "containerlog", "journald", "kmsg", "sensulog", "sensusocket", "syslog"} {
+		_, ok := createFuncs[plugin]
+		assert.True(t, ok, "monitor for plugin %q should be registered", plugin)
+	}
+}
+
+func TestNewMonitorOrDieWithSampleConfigs(t *testing.T) {
+	// The journald configurations are left out, since the journald log
+	// watcher is only built with the journald build tag.
+	for _, config := range []string{
+		"container-monitor.json",
+		"docker-monitor-filelog.json",
+		"kernel-monitor-filelog.json",
+		"kernel-monitor-frequency.json",
+		"kernel-monitor.json",
+		"sensu-monitor.json",
+		"sensu-socket-monitor.json",
+		"syslog-monitor.json",
+	} {
+		assert.NotNil(t, NewMonitorOrDie(filepath.Join("..", "..", "config", config)), config)
+	}
+}
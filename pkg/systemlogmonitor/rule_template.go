@@ -0,0 +1,108 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"bytes"
+	"text/template"
+
+	"github.com/golang/glog"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+)
+
+// messageKey is the key of the concatenated matched logs in the rule template
+// data. A named capture group with the same name takes precedence.
+const messageKey = "Message"
+
+// ruleOutput is the templated output of a matched rule.
+type ruleOutput struct {
+	// Reason is the short reason of the problem.
+	Reason string
+	// Message is the message of the problem.
+	Message string
+	// Annotations are the extra annotations of the problem.
+	Annotations map[string]string
+}
+
+// parseRuleTemplate parses a rule template. Missing keys are rendered as empty
+// strings, so that optional capture groups don't break the output.
+func parseRuleTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=zero").Parse(text)
+}
+
+// generateRuleData generates the template data of a rule from the concatenated
+// matched logs. The data contains the structured fields of the last matched log,
+// the concatenated matched logs as "Message", and the named capture groups of
+// the rule pattern, with the latter taking precedence.
+func generateRuleData(message string, fields map[string]string, rule *logRule) map[string]string {
+	data := map[string]string{}
+	for name, value := range fields {
+		data[name] = value
+	}
+	data[messageKey] = message
+	// The matched logs start with the log where the match starts, so the match
+	// in the concatenated logs is the same as the match in the log buffer.
+	submatches := rule.pattern.FindStringSubmatch(message)
+	if submatches == nil {
+		return data
+	}
+	for i, name := range rule.pattern.SubexpNames() {
+		if name != "" {
+			data[name] = submatches[i]
+		}
+	}
+	return data
+}
+
+// generateRuleOutput renders the reason, message and annotations of a rule with
+// the matched logs. The message defaults to the concatenated matched logs. A
+// template failing to execute falls back to its raw text, or the concatenated
+// matched logs for the message.
+func generateRuleOutput(logs []*logtypes.Log, rule *logRule) ruleOutput {
+	message := generateMessage(logs)
+	var fields map[string]string
+	if len(logs) > 0 {
+		fields = logs[len(logs)-1].Fields
+	}
+	data := generateRuleData(message, fields, rule)
+	output := ruleOutput{
+		Reason:  executeRuleTemplate(rule.reason, rule.Reason, data),
+		Message: message,
+	}
+	if rule.message != nil {
+		output.Message = executeRuleTemplate(rule.message, message, data)
+	}
+	if len(rule.annotations) > 0 {
+		output.Annotations = map[string]string{}
+		for key, tmpl := range rule.annotations {
+			output.Annotations[key] = executeRuleTemplate(tmpl, rule.Annotations[key], data)
+		}
+	}
+	return output
+}
+
+// executeRuleTemplate executes a rule template with the data, and returns the
+// fallback if the template fails.
+func executeRuleTemplate(tmpl *template.Template, fallback string, data map[string]string) string {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		glog.Errorf("Failed to execute %s template: %v", tmpl.Name(), err)
+		return fallback
+	}
+	return buf.String()
+}
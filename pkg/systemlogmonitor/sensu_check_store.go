@@ -0,0 +1,195 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// checkResult is a sensu check result recorded in the check store.
+type checkResult struct {
+	// Check is the name of the check.
+	Check string
+	// Level is the level of the check result.
+	Level CheckLevel
+	// Output is the output of the check result.
+	Output string
+	// Timestamp is the time of the check result.
+	Timestamp time.Time
+	// StaleAfter is the stale window of the check. Zero means the check never
+	// gets stale.
+	StaleAfter time.Duration
+	// MinOccurrences is the number of consecutive failed results before the
+	// check is reported failed. Zero or one reports the first failed result.
+	MinOccurrences int
+	// Fields are the fields of the check result, e.g. the runbook and owner of
+	// the check.
+	Fields map[string]string
+}
+
+// checkState is the state of a failed sensu check.
+type checkState struct {
+	checkResult
+	// Since is the time when the check started failing.
+	Since time.Time
+	// Occurrences is the number of consecutive failed results of the check.
+	Occurrences int
+	// Stale indicates that the check is stale and reported as UNKNOWN.
+	Stale bool
+}
+
+// reported checks whether the check has failed enough times to be reported.
+func (c *checkState) reported() bool {
+	return c.Occurrences >= c.MinOccurrences
+}
+
+// checkTransition is the change of a check state caused by a check result.
+type checkTransition string
+
+const (
+	// checkUnchanged means the check level doesn't change.
+	checkUnchanged checkTransition = "Unchanged"
+	// checkFailed means a passing check starts failing.
+	checkFailed checkTransition = "Failed"
+	// checkLevelChanged means a failed check keeps failing with another level.
+	checkLevelChanged checkTransition = "LevelChanged"
+	// checkResolved means a failed check passes again.
+	checkResolved checkTransition = "Resolved"
+)
+
+// checkStore stores the states of the failed sensu checks keyed by check name.
+// Passing checks are not stored. A failed check is only reported after it has
+// failed the minimum occurrences in a row. It is safe for concurrent use.
+type checkStore struct {
+	sync.Mutex
+	checks map[string]*checkState
+}
+
+func newCheckStore() *checkStore {
+	return &checkStore{checks: map[string]*checkState{}}
+}
+
+// Record records a check result and returns the transition it causes:
+// * A failed result of a passing check inserts the check.
+// * A failed result of a failed check updates the check.
+// * An OK result of a failed check resolves the check.
+// Transitions of checks not reported yet are not returned.
+func (s *checkStore) Record(result checkResult) checkTransition {
+	s.Lock()
+	defer s.Unlock()
+	state, ok := s.checks[result.Check]
+	if result.Level == CheckOK {
+		if !ok {
+			return checkUnchanged
+		}
+		delete(s.checks, result.Check)
+		if !state.reported() {
+			return checkUnchanged
+		}
+		return checkResolved
+	}
+	if !ok {
+		state = &checkState{Since: result.Timestamp}
+		s.checks[result.Check] = state
+	}
+	wasReported := ok && state.reported()
+	levelChanged := ok && state.Level != result.Level
+	state.checkResult = result
+	state.Occurrences++
+	state.Stale = false
+	switch {
+	case !wasReported && state.reported():
+		return checkFailed
+	case wasReported && levelChanged:
+		return checkLevelChanged
+	default:
+		return checkUnchanged
+	}
+}
+
+// Expire expires the failed checks without new results within their stale
+// windows at now. If staleAsUnknown is set, a stale check is marked UNKNOWN
+// first, however old its last result is, and removed on a later call after
+// another stale window, or else it is removed at once. So a check with a stale
+// window shorter than the interval of the calls is still reported UNKNOWN.
+// It returns the checks newly marked UNKNOWN and the removed checks. Checks not
+// reported yet are removed silently.
+func (s *checkStore) Expire(now time.Time, staleAsUnknown bool) (unknown, expired []checkState) {
+	s.Lock()
+	defer s.Unlock()
+	for check, state := range s.checks {
+		if state.StaleAfter <= 0 {
+			continue
+		}
+		age := now.Sub(state.Timestamp)
+		if age < state.StaleAfter {
+			continue
+		}
+		if !state.reported() {
+			delete(s.checks, check)
+			continue
+		}
+		if staleAsUnknown {
+			if !state.Stale {
+				state.Level = CheckUnknown
+				state.Stale = true
+				unknown = append(unknown, *state)
+				continue
+			}
+			if age < 2*state.StaleAfter {
+				continue
+			}
+		}
+		delete(s.checks, check)
+		expired = append(expired, *state)
+	}
+	sortChecks(unknown)
+	sortChecks(expired)
+	return unknown, expired
+}
+
+// Get returns the state of a failed check, including the checks not reported yet.
+func (s *checkStore) Get(check string) (checkState, bool) {
+	s.Lock()
+	defer s.Unlock()
+	state, ok := s.checks[check]
+	if !ok {
+		return checkState{}, false
+	}
+	return *state, true
+}
+
+// Failed returns a snapshot of all the reported failed checks sorted by check name.
+func (s *checkStore) Failed() []checkState {
+	s.Lock()
+	defer s.Unlock()
+	states := make([]checkState, 0, len(s.checks))
+	for _, state := range s.checks {
+		if state.reported() {
+			states = append(states, *state)
+		}
+	}
+	sortChecks(states)
+	return states
+}
+
+// sortChecks sorts the check states by check name.
+func sortChecks(states []checkState) {
+	sort.Slice(states, func(i, j int) bool { return states[i].Check < states[j].Check })
+}
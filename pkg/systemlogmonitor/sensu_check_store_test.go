@@ -0,0 +1,204 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckStoreTransitions(t *testing.T) {
+	s := newCheckStore()
+	for c, test := range []struct {
+		check      string
+		level      CheckLevel
+		transition checkTransition
+		failed     []string
+	}{
+		{check: "a", level: CheckOK, transition: checkUnchanged, failed: []string{}},
+		{check: "a", level: CheckWarning, transition: checkFailed, failed: []string{"a"}},
+		{check: "b", level: CheckCritical, transition: checkFailed, failed: []string{"a", "b"}},
+		{check: "a", level: CheckWarning, transition: checkUnchanged, failed: []string{"a", "b"}},
+		{check: "a", level: CheckCritical, transition: checkLevelChanged, failed: []string{"a", "b"}},
+		{check: "a", level: CheckOK, transition: checkResolved, failed: []string{"b"}},
+		{check: "a", level: CheckOK, transition: checkUnchanged, failed: []string{"b"}},
+		{check: "b", level: CheckUnknown, transition: checkLevelChanged, failed: []string{"b"}},
+		{check: "b", level: CheckOK, transition: checkResolved, failed: []string{}},
+	} {
+		timestamp := time.Unix(int64(c), 0)
+		transition := s.Record(checkResult{
+			Check:     test.check,
+			Level:     test.level,
+			Output:    fmt.Sprintf("output %d", c),
+			Timestamp: timestamp,
+		})
+		assert.Equal(t, test.transition, transition, "case %d", c+1)
+		failed := []string{}
+		for _, state := range s.Failed() {
+			failed = append(failed, state.Check)
+		}
+		assert.Equal(t, test.failed, failed, "case %d", c+1)
+	}
+}
+
+func TestCheckStoreKeepsFailingSince(t *testing.T) {
+	s := newCheckStore()
+	s.Record(checkResult{Check: "a", Level: CheckWarning, Output: "first", Timestamp: time.Unix(1, 0)})
+	s.Record(checkResult{Check: "a", Level: CheckCritical, Output: "second", Timestamp: time.Unix(2, 0), StaleAfter: time.Minute})
+	state, ok := s.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, checkState{
+		checkResult: checkResult{
+			Check:      "a",
+			Level:      CheckCritical,
+			Output:     "second",
+			Timestamp:  time.Unix(2, 0),
+			StaleAfter: time.Minute,
+		},
+		Since:       time.Unix(1, 0),
+		Occurrences: 2,
+	}, state)
+}
+
+func TestCheckStoreConcurrency(t *testing.T) {
+	s := newCheckStore()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			check := fmt.Sprintf("check-%d", i)
+			for j := 0; j < 100; j++ {
+				s.Record(checkResult{Check: check, Level: CheckCritical, Timestamp: time.Now(), StaleAfter: time.Hour})
+				s.Failed()
+				s.Expire(time.Now(), true)
+				s.Record(checkResult{Check: check, Level: CheckOK, Timestamp: time.Now()})
+			}
+			s.Record(checkResult{Check: check, Level: CheckWarning, Timestamp: time.Now(), StaleAfter: time.Hour})
+		}(i)
+	}
+	wg.Wait()
+	assert.Len(t, s.Failed(), 10)
+}
+
+func TestCheckStoreExpire(t *testing.T) {
+	names := func(states []checkState) []string {
+		checks := []string{}
+		for _, state := range states {
+			checks = append(checks, state.Check)
+		}
+		return checks
+	}
+	start := time.Unix(1000, 0)
+	for desc, test := range map[string]struct {
+		staleAsUnknown bool
+		// expected unknown and expired checks after 1, 2, 3 and 4 minutes.
+		unknown [][]string
+		expired [][]string
+	}{
+		"drop stale checks": {
+			unknown: [][]string{{}, {}, {}, {}},
+			expired: [][]string{{"a"}, {"b"}, {}, {}},
+		},
+		"report stale checks as unknown": {
+			staleAsUnknown: true,
+			unknown:        [][]string{{"a"}, {"b"}, {}, {}},
+			expired:        [][]string{{}, {"a"}, {}, {"b"}},
+		},
+	} {
+		s := newCheckStore()
+		s.Record(checkResult{Check: "a", Level: CheckCritical, Timestamp: start, StaleAfter: time.Minute})
+		s.Record(checkResult{Check: "b", Level: CheckCritical, Timestamp: start, StaleAfter: 2 * time.Minute})
+		s.Record(checkResult{Check: "c", Level: CheckCritical, Timestamp: start})
+		for i := range test.unknown {
+			unknown, expired := s.Expire(start.Add(time.Duration(i+1)*time.Minute), test.staleAsUnknown)
+			assert.Equal(t, test.unknown[i], names(unknown), "%s: unknown after %d minutes", desc, i+1)
+			assert.Equal(t, test.expired[i], names(expired), "%s: expired after %d minutes", desc, i+1)
+			for _, state := range unknown {
+				assert.Equal(t, CheckUnknown, state.Level)
+			}
+		}
+		// The check without a stale window never expires.
+		assert.Equal(t, []string{"c"}, names(s.Failed()), desc)
+	}
+}
+
+func TestCheckStoreExpireShortStaleWindow(t *testing.T) {
+	s := newCheckStore()
+	s.Record(checkResult{Check: "a", Level: CheckCritical, Timestamp: time.Unix(0, 0), StaleAfter: 10 * time.Second})
+	// The check is older than twice its stale window on the first call, but
+	// it's still reported unknown before it is removed.
+	unknown, expired := s.Expire(time.Unix(30, 0), true)
+	assert.Len(t, unknown, 1)
+	assert.Empty(t, expired)
+	unknown, expired = s.Expire(time.Unix(60, 0), true)
+	assert.Empty(t, unknown)
+	assert.Len(t, expired, 1)
+}
+
+func TestCheckStoreStaleCheckRecovers(t *testing.T) {
+	s := newCheckStore()
+	s.Record(checkResult{Check: "a", Level: CheckCritical, Timestamp: time.Unix(0, 0), StaleAfter: time.Minute})
+	unknown, _ := s.Expire(time.Unix(60, 0), true)
+	assert.Len(t, unknown, 1)
+	// A new result makes the check fresh again.
+	assert.Equal(t, checkLevelChanged, s.Record(checkResult{Check: "a", Level: CheckCritical, Timestamp: time.Unix(70, 0), StaleAfter: time.Minute}))
+	state, _ := s.Get("a")
+	assert.False(t, state.Stale)
+	unknown, expired := s.Expire(time.Unix(120, 0), true)
+	assert.Empty(t, unknown)
+	assert.Empty(t, expired)
+}
+
+func TestCheckStoreMinOccurrences(t *testing.T) {
+	s := newCheckStore()
+	for c, test := range []struct {
+		level      CheckLevel
+		transition checkTransition
+		reported   bool
+	}{
+		{level: CheckWarning, transition: checkUnchanged, reported: false},
+		// A passing result resets the occurrences.
+		{level: CheckOK, transition: checkUnchanged, reported: false},
+		{level: CheckWarning, transition: checkUnchanged, reported: false},
+		{level: CheckCritical, transition: checkUnchanged, reported: false},
+		{level: CheckCritical, transition: checkFailed, reported: true},
+		{level: CheckWarning, transition: checkLevelChanged, reported: true},
+		{level: CheckOK, transition: checkResolved, reported: false},
+	} {
+		transition := s.Record(checkResult{
+			Check:          "flaky",
+			Level:          test.level,
+			Timestamp:      time.Unix(int64(c), 0),
+			MinOccurrences: 3,
+		})
+		assert.Equal(t, test.transition, transition, "case %d", c+1)
+		assert.Equal(t, test.reported, len(s.Failed()) == 1, "case %d", c+1)
+	}
+
+	// Checks not reported yet expire silently.
+	s.Record(checkResult{Check: "flaky", Level: CheckCritical, StaleAfter: time.Minute, MinOccurrences: 3})
+	unknown, expired := s.Expire(time.Unix(0, 0).Add(time.Hour), true)
+	assert.Empty(t, unknown)
+	assert.Empty(t, expired)
+	_, ok := s.Get("flaky")
+	assert.False(t, ok)
+}
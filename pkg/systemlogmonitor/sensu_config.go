@@ -0,0 +1,460 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/sensulog"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+// CheckLevel is the level of a sensu check result.
+type CheckLevel string
+
+const (
+	// CheckOK means the check passed.
+	CheckOK CheckLevel = "OK"
+	// CheckWarning means the check failed with a warning.
+	CheckWarning CheckLevel = "WARNING"
+	// CheckCritical means the check failed critically.
+	CheckCritical CheckLevel = "CRITICAL"
+	// CheckUnknown means the check could not determine the state.
+	CheckUnknown CheckLevel = "UNKNOWN"
+)
+
+// defaultStatusLevels is the sensu check exit status convention, which is
+// the same as the nagios plugin convention.
+var defaultStatusLevels = map[int]CheckLevel{
+	0: CheckOK,
+	1: CheckWarning,
+	2: CheckCritical,
+}
+
+// defaultCheckConditionReason is the default condition reason when a check
+// mapped to the condition fails.
+const defaultCheckConditionReason = "SensuCheckFailed"
+
+// CheckCondition maps sensu checks to a node condition.
+type CheckCondition struct {
+	// Check is the check name or a glob pattern of check names, e.g. "disk_usage*".
+	Check string `json:"check"`
+	// Condition is the type of the node condition the failed checks set. The
+	// condition must be one of the default conditions of the monitor.
+	Condition string `json:"condition"`
+	// Reason is the short reason of the condition when the checks fail.
+	Reason string `json:"reason,omitempty"`
+}
+
+// CheckExpiry overrides the stale window of sensu checks.
+type CheckExpiry struct {
+	// Check is the check name or a glob pattern of check names.
+	Check string `json:"check"`
+	// StaleAfterString is the stale window string of the checks, e.g. "10m".
+	StaleAfterString string `json:"staleAfter"`
+	// StaleAfter is the stale window of the checks.
+	StaleAfter time.Duration `json:"-"`
+}
+
+// CheckOccurrences overrides the minimum occurrences of sensu checks.
+type CheckOccurrences struct {
+	// Check is the check name or a glob pattern of check names.
+	Check string `json:"check"`
+	// MinOccurrences is the number of consecutive failed results before the
+	// checks affect the node conditions.
+	MinOccurrences int `json:"minOccurrences"`
+}
+
+// SensuMonitorConfig is the configuration of sensu log monitor. The rules of
+// the embedded MonitorConfig match the check results, and must be temporary
+// rules without count, since the node conditions are set by the failed checks.
+type SensuMonitorConfig struct {
+	MonitorConfig
+	// StatusLevels maps the check exit status codes to check levels. Status codes
+	// not configured fall back to the default mapping: 0 is OK, 1 is WARNING and
+	// 2 is CRITICAL. Any other status code is UNKNOWN.
+	StatusLevels map[int]CheckLevel `json:"statusLevels,omitempty"`
+	// CheckConditions map the checks to their own node conditions. The first
+	// matching mapping is used. Failed checks not mapped to any condition are
+	// reported in the default conditions not used by any mapping.
+	CheckConditions []CheckCondition `json:"checkConditions,omitempty"`
+	// StaleAfterString is the default stale window string of failed checks. A
+	// failed check without new results within its stale window is stale. Empty
+	// or zero disables the expiry of failed checks.
+	StaleAfterString string `json:"staleAfter,omitempty"`
+	// StaleAfter is the default stale window of failed checks.
+	StaleAfter time.Duration `json:"-"`
+	// StaleIntervals derives the stale window of a check from the interval of
+	// the check in the check result, e.g. 3 means a check is stale after missing
+	// 3 runs. It takes precedence over StaleAfter when the check result carries
+	// an interval. Zero disables the derivation.
+	StaleIntervals int `json:"staleIntervals,omitempty"`
+	// CheckExpiries override the stale window of the matching checks. The first
+	// matching override is used, and it takes precedence over the others.
+	CheckExpiries []CheckExpiry `json:"checkExpiries,omitempty"`
+	// StaleAsUnknown reports stale checks as UNKNOWN for another stale window
+	// before they are dropped. By default stale checks are dropped at once.
+	StaleAsUnknown bool `json:"staleAsUnknown,omitempty"`
+	// IncludeChecks are the patterns of the checks the monitor handles. Empty
+	// means all checks. A pattern is a glob pattern of check names, or a regular
+	// expression enclosed in slashes, e.g. "/^disk_(usage|inodes)$/".
+	IncludeChecks []string `json:"includeChecks,omitempty"`
+	// ExcludeChecks are the patterns of the checks the monitor ignores. It takes
+	// precedence over IncludeChecks.
+	ExcludeChecks []string `json:"excludeChecks,omitempty"`
+	// CheckOccurrences override the minimum occurrences of the matching checks.
+	// The first matching override is used. The checks without an override use
+	// the occurrences in the check result.
+	CheckOccurrences []CheckOccurrences `json:"checkOccurrences,omitempty"`
+	// EventMessageTemplate is the go template of the event message generated
+	// when a check fails, e.g. "{{.Check}} failed, see {{.Runbook}}". The data
+	// of the template is checkTemplateData. Empty uses the default template.
+	EventMessageTemplate string `json:"eventMessageTemplate,omitempty"`
+	// CheckMessageTemplate is the go template of the message of each failed
+	// check in the condition message. The data of the template is
+	// checkTemplateData. Empty uses the default template.
+	CheckMessageTemplate string `json:"checkMessageTemplate,omitempty"`
+
+	include      *checkMatcher
+	exclude      *checkMatcher
+	eventMessage *template.Template
+	checkMessage *template.Template
+}
+
+const (
+	// defaultEventMessageTemplate is the default template of the event message
+	// generated when a check fails.
+	defaultEventMessageTemplate = "Sensu check: {{.Check}} is {{.Level}}" +
+		"{{with .Owner}}, owner: {{.}}{{end}}{{with .Runbook}}, runbook: {{.}}{{end}}"
+	// defaultCheckMessageTemplate is the default template of the message of a
+	// failed check in the condition message.
+	defaultCheckMessageTemplate = "{{.Check}}: {{.Output}}{{with .Runbook}} (runbook: {{.}}){{end}}"
+)
+
+var (
+	defaultEventMessage = template.Must(template.New("event").Parse(defaultEventMessageTemplate))
+	defaultCheckMessage = template.Must(template.New("check").Parse(defaultCheckMessageTemplate))
+)
+
+// checkTemplateData is the data of the message templates of a failed check.
+type checkTemplateData struct {
+	// Check is the name of the check.
+	Check string
+	// Level is the level of the check result.
+	Level CheckLevel
+	// Output is the output of the check result.
+	Output string
+	// Client is the sensu client which ran the check.
+	Client string
+	// Runbook is the runbook url of the check.
+	Runbook string
+	// Owner is the owner of the check.
+	Owner string
+	// Contacts are the comma separated contacts of the check.
+	Contacts string
+	// Slack is the slack channel of the check.
+	Slack string
+	// Info is the additional information of the check.
+	Info string
+	// Fields are all the fields of the check result.
+	Fields map[string]string
+}
+
+// checkMatcher matches check names against glob patterns and regular expressions.
+type checkMatcher struct {
+	globs   []string
+	regexps []*regexp.Regexp
+}
+
+// newCheckMatcher creates a check matcher from patterns. A pattern enclosed in
+// slashes is a regular expression, otherwise it is a glob pattern.
+func newCheckMatcher(patterns []string) (*checkMatcher, error) {
+	m := &checkMatcher{}
+	for _, pattern := range patterns {
+		if len(pattern) >= 2 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+			reg, err := regexp.Compile(pattern[1 : len(pattern)-1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid check regular expression %q: %v", pattern, err)
+			}
+			m.regexps = append(m.regexps, reg)
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid check pattern %q: %v", pattern, err)
+		}
+		m.globs = append(m.globs, pattern)
+	}
+	return m, nil
+}
+
+// Match checks whether the check name matches any pattern.
+func (m *checkMatcher) Match(check string) bool {
+	for _, glob := range m.globs {
+		if matched, _ := path.Match(glob, check); matched {
+			return true
+		}
+	}
+	for _, reg := range m.regexps {
+		if reg.MatchString(check) {
+			return true
+		}
+	}
+	return false
+}
+
+// Empty checks whether the matcher has no pattern.
+func (m *checkMatcher) Empty() bool {
+	return len(m.globs) == 0 && len(m.regexps) == 0
+}
+
+// ApplyConfiguration applies default configurations and parses the stale windows.
+func (sc *SensuMonitorConfig) ApplyConfiguration() error {
+	if err := (&sc.MonitorConfig).ApplyConfiguration(); err != nil {
+		return err
+	}
+	if sc.StatusLevels == nil {
+		sc.StatusLevels = map[int]CheckLevel{}
+	}
+	for status, level := range defaultStatusLevels {
+		if _, ok := sc.StatusLevels[status]; !ok {
+			sc.StatusLevels[status] = level
+		}
+	}
+	for i := range sc.CheckConditions {
+		if sc.CheckConditions[i].Reason == "" {
+			sc.CheckConditions[i].Reason = defaultCheckConditionReason
+		}
+	}
+	if sc.StaleAfterString != "" {
+		staleAfter, err := time.ParseDuration(sc.StaleAfterString)
+		if err != nil {
+			return fmt.Errorf("error in parsing stale window %q: %v", sc.StaleAfterString, err)
+		}
+		sc.StaleAfter = staleAfter
+	}
+	for i := range sc.CheckExpiries {
+		ce := &sc.CheckExpiries[i]
+		staleAfter, err := time.ParseDuration(ce.StaleAfterString)
+		if err != nil {
+			return fmt.Errorf("error in parsing stale window %q of check %q: %v", ce.StaleAfterString, ce.Check, err)
+		}
+		ce.StaleAfter = staleAfter
+	}
+	var err error
+	if sc.include, err = newCheckMatcher(sc.IncludeChecks); err != nil {
+		return err
+	}
+	if sc.exclude, err = newCheckMatcher(sc.ExcludeChecks); err != nil {
+		return err
+	}
+	sc.eventMessage = defaultEventMessage
+	if sc.EventMessageTemplate != "" {
+		if sc.eventMessage, err = template.New("event").Parse(sc.EventMessageTemplate); err != nil {
+			return fmt.Errorf("error in parsing event message template %q: %v", sc.EventMessageTemplate, err)
+		}
+	}
+	sc.checkMessage = defaultCheckMessage
+	if sc.CheckMessageTemplate != "" {
+		if sc.checkMessage, err = template.New("check").Parse(sc.CheckMessageTemplate); err != nil {
+			return fmt.Errorf("error in parsing check message template %q: %v", sc.CheckMessageTemplate, err)
+		}
+	}
+	return nil
+}
+
+// Validate verifies whether the settings in SensuMonitorConfig are valid.
+func (sc SensuMonitorConfig) Validate() error {
+	if err := sc.ValidateRules(); err != nil {
+		return err
+	}
+	for _, rule := range sc.Rules {
+		// The conditions are set by the failed checks, and the check results
+		// are not counted.
+		if rule.Type != types.Temp || rule.Count > 1 {
+			return fmt.Errorf("only temporary rules without count are supported by sensu monitor, got rule %q of type %q with count %d",
+				rule.Reason, rule.Type, rule.Count)
+		}
+	}
+	for status, level := range sc.StatusLevels {
+		switch level {
+		case CheckOK, CheckWarning, CheckCritical, CheckUnknown:
+		default:
+			return fmt.Errorf("unknown check level %q for status %d", level, status)
+		}
+	}
+	for _, cc := range sc.CheckConditions {
+		if _, err := path.Match(cc.Check, ""); err != nil {
+			return fmt.Errorf("invalid check pattern %q: %v", cc.Check, err)
+		}
+		if sc.defaultCondition(cc.Condition) == nil {
+			return fmt.Errorf("condition %q of check %q is not a default condition", cc.Condition, cc.Check)
+		}
+	}
+	if sc.StaleAfter < 0 || sc.StaleIntervals < 0 {
+		return fmt.Errorf("unexpected negative stale window %v or stale intervals %d", sc.StaleAfter, sc.StaleIntervals)
+	}
+	for _, ce := range sc.CheckExpiries {
+		if _, err := path.Match(ce.Check, ""); err != nil {
+			return fmt.Errorf("invalid check pattern %q: %v", ce.Check, err)
+		}
+		if ce.StaleAfter < 0 {
+			return fmt.Errorf("unexpected negative stale window %v of check %q", ce.StaleAfter, ce.Check)
+		}
+	}
+	for _, co := range sc.CheckOccurrences {
+		if _, err := path.Match(co.Check, ""); err != nil {
+			return fmt.Errorf("invalid check pattern %q: %v", co.Check, err)
+		}
+		if co.MinOccurrences < 0 {
+			return fmt.Errorf("unexpected negative minimum occurrences %d of check %q", co.MinOccurrences, co.Check)
+		}
+	}
+	return nil
+}
+
+// handlesCheck checks whether the monitor handles the check according to the
+// include and exclude patterns.
+func (sc SensuMonitorConfig) handlesCheck(check string) bool {
+	if sc.exclude != nil && sc.exclude.Match(check) {
+		return false
+	}
+	return sc.include == nil || sc.include.Empty() || sc.include.Match(check)
+}
+
+// minOccurrences returns the minimum occurrences of a check. The occurrences
+// is the occurrences in the check result, or empty if unknown.
+func (sc SensuMonitorConfig) minOccurrences(check string, occurrences string) int {
+	for _, co := range sc.CheckOccurrences {
+		if matched, _ := path.Match(co.Check, check); matched {
+			return co.MinOccurrences
+		}
+	}
+	if n, err := strconv.Atoi(occurrences); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// staleAfter returns the stale window of a check. The interval is the check
+// interval in the check result, or empty if unknown. Zero means the check never
+// gets stale.
+func (sc SensuMonitorConfig) staleAfter(check string, interval string) time.Duration {
+	for _, ce := range sc.CheckExpiries {
+		if matched, _ := path.Match(ce.Check, check); matched {
+			return ce.StaleAfter
+		}
+	}
+	if sc.StaleIntervals > 0 {
+		if seconds, err := strconv.Atoi(interval); err == nil && seconds > 0 {
+			return time.Duration(sc.StaleIntervals*seconds) * time.Second
+		}
+	}
+	return sc.StaleAfter
+}
+
+// checkCondition returns the condition mapping of a check, or nil if the check
+// is not mapped to any condition.
+func (sc SensuMonitorConfig) checkCondition(check string) *CheckCondition {
+	for i := range sc.CheckConditions {
+		if matched, _ := path.Match(sc.CheckConditions[i].Check, check); matched {
+			return &sc.CheckConditions[i]
+		}
+	}
+	return nil
+}
+
+// isMappedCondition checks whether any checks are mapped to the condition.
+func (sc SensuMonitorConfig) isMappedCondition(conditionType string) bool {
+	for _, cc := range sc.CheckConditions {
+		if cc.Condition == conditionType {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultCondition returns the default condition of the condition type, or nil
+// if the condition type is not configured.
+func (sc SensuMonitorConfig) defaultCondition(conditionType string) *types.Condition {
+	for i := range sc.DefaultConditions {
+		if sc.DefaultConditions[i].Type == conditionType {
+			return &sc.DefaultConditions[i]
+		}
+	}
+	return nil
+}
+
+// checkLevel returns the check level of the exit status in a check result.
+func (sc SensuMonitorConfig) checkLevel(status string) CheckLevel {
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return CheckUnknown
+	}
+	if level, ok := sc.StatusLevels[code]; ok {
+		return level
+	}
+	return CheckUnknown
+}
+
+// formatEventMessage formats the event message of a failed check.
+func (sc SensuMonitorConfig) formatEventMessage(state checkState) string {
+	return formatCheckMessage(sc.eventMessage, defaultEventMessage, state)
+}
+
+// formatCheckMessage formats the message of a failed check in the condition
+// message.
+func (sc SensuMonitorConfig) formatCheckMessage(state checkState) string {
+	return formatCheckMessage(sc.checkMessage, defaultCheckMessage, state)
+}
+
+// formatCheckMessage executes the message template with the failed check. It
+// falls back to the default template if the template fails to execute, e.g.
+// when the template references an unknown field.
+func formatCheckMessage(tmpl, defaultTmpl *template.Template, state checkState) string {
+	data := checkTemplateData{
+		Check:    state.Check,
+		Level:    state.Level,
+		Output:   state.Output,
+		Client:   state.Fields[sensulog.ClientField],
+		Runbook:  state.Fields[sensulog.RunbookField],
+		Owner:    state.Fields[sensulog.OwnerField],
+		Contacts: state.Fields[sensulog.ContactsField],
+		Slack:    state.Fields[sensulog.SlackField],
+		Info:     state.Fields[sensulog.InfoField],
+		Fields:   state.Fields,
+	}
+	if tmpl == nil {
+		tmpl = defaultTmpl
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		glog.Errorf("Failed to execute message template %q for check %q: %v", tmpl.Name(), state.Check, err)
+		buf.Reset()
+		// The default template never fails.
+		defaultTmpl.Execute(&buf, data)
+	}
+	return buf.String()
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func TestCheckLevel(t *testing.T) {
+	for desc, test := range map[string]struct {
+		config   string
+		expected map[string]CheckLevel
+	}{
+		"default status levels": {
+			config: `{}`,
+			expected: map[string]CheckLevel{
+				"0":    CheckOK,
+				"1":    CheckWarning,
+				"2":    CheckCritical,
+				"3":    CheckUnknown,
+				"127":  CheckUnknown,
+				"":     CheckUnknown,
+				"fail": CheckUnknown,
+			},
+		},
+		"overridden status levels": {
+			config: `{"statusLevels": {"1": "CRITICAL", "3": "WARNING"}}`,
+			expected: map[string]CheckLevel{
+				"0": CheckOK,
+				"1": CheckCritical,
+				"2": CheckCritical,
+				"3": CheckWarning,
+				"4": CheckUnknown,
+			},
+		},
+	} {
+		var sc SensuMonitorConfig
+		assert.NoError(t, json.Unmarshal([]byte(test.config), &sc), desc)
+		assert.NoError(t, (&sc).ApplyConfiguration(), desc)
+		assert.NoError(t, sc.Validate(), desc)
+		for status, level := range test.expected {
+			assert.Equal(t, level, sc.checkLevel(status), "%s: status %q", desc, status)
+		}
+	}
+}
+
+func TestValidateStatusLevels(t *testing.T) {
+	sc := SensuMonitorConfig{StatusLevels: map[int]CheckLevel{2: "FATAL"}}
+	assert.NoError(t, (&sc).ApplyConfiguration())
+	assert.Error(t, sc.Validate())
+}
+
+func TestStaleAfter(t *testing.T) {
+	var sc SensuMonitorConfig
+	assert.NoError(t, json.Unmarshal([]byte(`{
+		"staleAfter": "10m",
+		"staleIntervals": 3,
+		"checkExpiries": [{"check": "ntp*", "staleAfter": "1h"}, {"check": "cron", "staleAfter": "0"}]
+	}`), &sc))
+	assert.NoError(t, (&sc).ApplyConfiguration())
+	assert.NoError(t, sc.Validate())
+	for _, test := range []struct {
+		check    string
+		interval string
+		expected time.Duration
+	}{
+		{check: "disk", interval: "", expected: 10 * time.Minute},
+		{check: "disk", interval: "0", expected: 10 * time.Minute},
+		{check: "disk", interval: "60", expected: 3 * time.Minute},
+		{check: "ntp_offset", interval: "60", expected: time.Hour},
+		{check: "cron", interval: "60", expected: 0},
+	} {
+		assert.Equal(t, test.expected, sc.staleAfter(test.check, test.interval), "check %q with interval %q", test.check, test.interval)
+	}
+
+	assert.Error(t, (&SensuMonitorConfig{StaleAfterString: "10"}).ApplyConfiguration())
+}
+
+func TestHandlesCheck(t *testing.T) {
+	for desc, test := range map[string]struct {
+		include  []string
+		exclude  []string
+		expected map[string]bool
+	}{
+		"all checks by default": {
+			expected: map[string]bool{"disk": true, "ntp": true},
+		},
+		"include globs and regular expressions": {
+			include:  []string{"disk_*", "/^(ntp|chrony)$/"},
+			expected: map[string]bool{"disk_usage": true, "ntp": true, "chrony": true, "ntp_offset": false, "memory": false},
+		},
+		"exclude takes precedence": {
+			include:  []string{"disk_*"},
+			exclude:  []string{"disk_*_tmp", "/inodes/"},
+			expected: map[string]bool{"disk_usage": true, "disk_usage_tmp": false, "disk_inodes": false},
+		},
+		"exclude only": {
+			exclude:  []string{"noisy"},
+			expected: map[string]bool{"noisy": false, "disk": true},
+		},
+	} {
+		sc := SensuMonitorConfig{IncludeChecks: test.include, ExcludeChecks: test.exclude}
+		assert.NoError(t, (&sc).ApplyConfiguration(), desc)
+		for check, expected := range test.expected {
+			assert.Equal(t, expected, sc.handlesCheck(check), "%s: check %q", desc, check)
+		}
+	}
+
+	assert.Error(t, (&SensuMonitorConfig{IncludeChecks: []string{"/disk(/"}}).ApplyConfiguration())
+	assert.Error(t, (&SensuMonitorConfig{ExcludeChecks: []string{"disk["}}).ApplyConfiguration())
+}
+
+func TestMinOccurrences(t *testing.T) {
+	sc := SensuMonitorConfig{
+		CheckOccurrences: []CheckOccurrences{{Check: "flaky*", MinOccurrences: 5}},
+	}
+	assert.NoError(t, (&sc).ApplyConfiguration())
+	assert.NoError(t, sc.Validate())
+	assert.Equal(t, 5, sc.minOccurrences("flaky_dns", "2"))
+	assert.Equal(t, 2, sc.minOccurrences("disk", "2"))
+	assert.Equal(t, 1, sc.minOccurrences("disk", "0"))
+	assert.Equal(t, 1, sc.minOccurrences("disk", ""))
+}
+
+func TestValidateSensuRules(t *testing.T) {
+	for desc, test := range map[string]struct {
+		rule  logtypes.Rule
+		valid bool
+	}{
+		"temporary rule": {
+			rule:  logtypes.Rule{Type: types.Temp, Reason: "DiskFull", Pattern: ".*disk full.*"},
+			valid: true,
+		},
+		"permanent rule": {
+			rule: logtypes.Rule{Type: types.Perm, Condition: "DiskPressure", Reason: "DiskFull", Pattern: ".*disk full.*"},
+		},
+		"temporary rule with count": {
+			rule: logtypes.Rule{Type: types.Temp, Reason: "DiskFull", Pattern: ".*disk full.*", Count: 3, Window: time.Minute},
+		},
+	} {
+		sc := SensuMonitorConfig{MonitorConfig: MonitorConfig{Rules: []logtypes.Rule{test.rule}}}
+		assert.Equal(t, test.valid, sc.Validate() == nil, desc)
+	}
+}
@@ -0,0 +1,324 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers"
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/sensulog"
+	watchertypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/types"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+	"k8s.io/node-problem-detector/pkg/util"
+	"k8s.io/node-problem-detector/pkg/util/tomb"
+)
+
+// SensulogMonitor monitors the sensu check results and reports the failed
+// checks as node conditions.
+type SensulogMonitor struct {
+	watcher watchertypes.LogWatcher
+	buffer  LogBuffer
+	config  SensuMonitorConfig
+	// rules are the compiled temporary rules matching the check results.
+	rules      []*logRule
+	conditions []types.Condition
+	logCh      <-chan *logtypes.Log
+	output     chan *types.Status
+	tomb       *tomb.Tomb
+	// checks are the failed checks reported by the monitor.
+	checks *checkStore
+}
+
+// NewSensuLogMonitorOrDie create a new SensulogMonitor, panic if error occurs.
+func NewSensuLogMonitorOrDie(configPath string) types.Monitor {
+	s := &SensulogMonitor{
+		tomb:   tomb.NewTomb(),
+		checks: newCheckStore(),
+	}
+	f, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		glog.Fatalf("Failed to read configuration file %q: %v", configPath, err)
+	}
+	err = json.Unmarshal(f, &s.config)
+	if err != nil {
+		glog.Fatalf("Failed to unmarshal configuration file %q: %v", configPath, err)
+	}
+
+	// Apply configurations
+	err = (&s.config).ApplyConfiguration()
+	if err != nil {
+		glog.Fatalf("Failed to apply configuration for %q: %v", configPath, err)
+	}
+	err = s.config.Validate()
+	if err != nil {
+		glog.Fatalf("Failed to validate sensu monitor config %+v: %v", s.config, err)
+	}
+	s.rules, err = compileRules(s.config.Rules)
+	if err != nil {
+		glog.Fatalf("Failed to compile matching rules %+v: %v", s.config.Rules, err)
+	}
+	glog.Infof("Finish parsing log monitor config file: %+v", s.config)
+	s.watcher = logwatchers.GetLogWatcherOrDie(s.config.WatcherConfig)
+	s.buffer = NewLogBuffer(s.config.BufferSize)
+	// A 1000 size channel should be big enough.
+	s.output = make(chan *types.Status, 1000)
+	return s
+}
+
+func (s *SensulogMonitor) Start() (<-chan *types.Status, error) {
+	glog.Info("Start sensu log monitor")
+	var err error
+	s.logCh, err = s.watcher.Watch()
+	if err != nil {
+		return nil, err
+	}
+	go s.monitorLoop()
+	return s.output, nil
+}
+
+func (s *SensulogMonitor) Stop() {
+	glog.Info("Stop sensu log monitor")
+	s.tomb.Stop()
+}
+
+// checkExpiryInterval is the interval sensu log monitor expires stale checks.
+const checkExpiryInterval = 30 * time.Second
+
+// monitorLoop is the main loop of sensu log monitor.
+func (s *SensulogMonitor) monitorLoop() {
+	defer s.tomb.Done()
+	s.initializeStatus()
+	ticker := time.NewTicker(checkExpiryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case log := <-s.logCh:
+			s.parseLog(log)
+		case now := <-ticker.C:
+			s.expireChecks(now)
+		case <-s.tomb.Stopping():
+			s.watcher.Stop()
+			glog.Infof("Sensu log monitor stopped")
+			return
+		}
+	}
+}
+
+// parseLog parses one check result.
+func (s *SensulogMonitor) parseLog(log *logtypes.Log) {
+	events := s.matchRules(log)
+	check := log.Fields[sensulog.CheckField]
+	if !s.config.handlesCheck(check) {
+		glog.V(5).Infof("Ignore check %q", check)
+		if len(events) > 0 {
+			status := &types.Status{
+				Source:     s.config.Source,
+				Events:     events,
+				Conditions: s.conditions,
+			}
+			glog.V(3).Infof("New status generated: %+v", status)
+			s.output <- status
+		}
+		return
+	}
+	level := s.config.checkLevel(log.Fields[sensulog.StatusField])
+	glog.V(3).Infof("Check %q is %s with status %q", check, level, log.Fields[sensulog.StatusField])
+
+	transition := s.checks.Record(checkResult{
+		Check:          check,
+		Level:          level,
+		Output:         log.Message,
+		Timestamp:      log.Timestamp,
+		StaleAfter:     s.config.staleAfter(check, log.Fields[sensulog.IntervalField]),
+		MinOccurrences: s.config.minOccurrences(check, log.Fields[sensulog.OccurrencesField]),
+		Fields:         log.Fields,
+	})
+	if transition == checkFailed || transition == checkLevelChanged {
+		if state, ok := s.checks.Get(check); ok {
+			events = append(events, types.Event{
+				Severity:  types.Info,
+				Timestamp: log.Timestamp,
+				Reason:    "SensuCheckFailed",
+				Message:   s.config.formatEventMessage(state),
+			})
+		}
+	}
+	status := s.generateSensuStatus(s.checks.Failed(), events, log.Timestamp)
+	glog.V(3).Infof("New status generated: %+v", status)
+	s.output <- status
+}
+
+// matchRules pushes the check result into the log buffer, and returns the
+// events of the temporary rules it matches, the same way the log monitor does.
+func (s *SensulogMonitor) matchRules(log *logtypes.Log) []types.Event {
+	if len(s.rules) == 0 {
+		return nil
+	}
+	s.buffer.Push(log)
+	var events []types.Event
+	for _, rule := range s.rules {
+		matched := s.buffer.Match(rule.pattern)
+		if len(matched) == 0 || !rule.matchFields(matched[len(matched)-1].Fields) {
+			continue
+		}
+		if rule.excluded(matched) {
+			glog.V(3).Infof("Rule %q matched %q, but it is excluded", rule.Reason, generateMessage(matched))
+			continue
+		}
+		events = append(events, generateTempEvent(matched, rule))
+	}
+	return events
+}
+
+// expireChecks expires the stale checks and reports the status if any check
+// expires.
+func (s *SensulogMonitor) expireChecks(now time.Time) {
+	unknown, expired := s.checks.Expire(now, s.config.StaleAsUnknown)
+	if len(unknown) == 0 && len(expired) == 0 {
+		return
+	}
+	var events []types.Event
+	for _, state := range unknown {
+		glog.Infof("Check %q has no result since %v, report it as %s", state.Check, state.Timestamp, CheckUnknown)
+		events = append(events, generateCheckExpiryEvent(state, "SensuCheckStale",
+			fmt.Sprintf("reported as %s", CheckUnknown), now))
+	}
+	for _, state := range expired {
+		glog.Infof("Check %q has no result since %v, drop it", state.Check, state.Timestamp)
+		events = append(events, generateCheckExpiryEvent(state, "SensuCheckExpired", "dropped", now))
+	}
+	status := s.generateSensuStatus(s.checks.Failed(), events, now)
+	glog.V(3).Infof("New status generated: %+v", status)
+	s.output <- status
+}
+
+// generateCheckExpiryEvent generates an event for a stale check.
+func generateCheckExpiryEvent(state checkState, reason, action string, timestamp time.Time) types.Event {
+	return types.Event{
+		Severity:  types.Info,
+		Timestamp: timestamp,
+		Reason:    reason,
+		Message: fmt.Sprintf("Sensu check: %s has no result within %v since %v, %s",
+			state.Check, state.StaleAfter, state.Timestamp, action),
+	}
+}
+
+// someChecksFailedReason is the condition reason when failed checks not mapped
+// to any condition are reported in the default conditions.
+const someChecksFailedReason = "SomeChecksFailed"
+
+// generateSensuStatus generates status from the failed checks.
+func (s *SensulogMonitor) generateSensuStatus(checks []checkState, events []types.Event, timestamp time.Time) *types.Status {
+	// Group the failed checks by the conditions they are mapped to.
+	failed := map[string][]checkState{}
+	var unmapped []checkState
+	for _, state := range checks {
+		if cc := s.config.checkCondition(state.Check); cc != nil {
+			failed[cc.Condition] = append(failed[cc.Condition], state)
+		} else {
+			unmapped = append(unmapped, state)
+		}
+	}
+
+	for i := range s.conditions {
+		condition := &s.conditions[i]
+		// The checks are sorted by name, so the reason is deterministic.
+		checks := failed[condition.Type]
+		reason := someChecksFailedReason
+		if s.config.isMappedCondition(condition.Type) {
+			if len(checks) > 0 {
+				reason = s.config.checkCondition(checks[0].Check).Reason
+			}
+		} else {
+			checks = unmapped
+		}
+
+		status := types.True
+		if allStale(checks) {
+			// The state of the checks is unknown when they are all stale.
+			status = types.Unknown
+		}
+		message := s.generateChecksMessage(checks)
+		if len(checks) == 0 {
+			status = types.False
+			reason = ""
+			message = ""
+			if defaultCondition := s.config.defaultCondition(condition.Type); defaultCondition != nil {
+				reason = defaultCondition.Reason
+				message = defaultCondition.Message
+			}
+		}
+		// Update transition timestamp when the condition changes. Condition is
+		// considered to be changed only when status or reason changes.
+		if condition.Status != status || condition.Reason != reason {
+			condition.Transition = timestamp
+			events = append(events, util.GenerateConditionChangeEvent(
+				condition.Type,
+				status,
+				reason,
+				timestamp,
+			))
+		}
+		condition.Status = status
+		condition.Reason = reason
+		condition.Message = message
+	}
+	return &types.Status{
+		Source: s.config.Source,
+		// TODO(random-liu): Aggregate events and conditions and then do periodically report.
+		Events:     events,
+		Conditions: s.conditions,
+	}
+}
+
+// generateChecksMessage generates the condition message from the failed checks.
+func (s *SensulogMonitor) generateChecksMessage(checks []checkState) string {
+	messages := []string{}
+	for _, state := range checks {
+		messages = append(messages, s.config.formatCheckMessage(state))
+	}
+	return strings.Join(messages, "; ")
+}
+
+// initializeStatus initializes the internal condition and also reports it to the node problem detector.
+func (s *SensulogMonitor) initializeStatus() {
+	// Initialize the default node conditions
+	s.conditions = initialConditions(s.config.DefaultConditions)
+	glog.Infof("Initialize condition generated: %+v", s.conditions)
+	// Update the initial status
+	s.output <- &types.Status{
+		Source:     s.config.Source,
+		Conditions: s.conditions,
+	}
+}
+
+// allStale checks whether all the checks are stale.
+func allStale(checks []checkState) bool {
+	for _, state := range checks {
+		if !state.Stale {
+			return false
+		}
+	}
+	return len(checks) > 0
+}
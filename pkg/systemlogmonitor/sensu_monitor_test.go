@@ -0,0 +1,320 @@
+/*
+Copyright 2018 The Kubernetes Authors All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package systemlogmonitor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"k8s.io/node-problem-detector/pkg/systemlogmonitor/logwatchers/sensulog"
+	logtypes "k8s.io/node-problem-detector/pkg/systemlogmonitor/types"
+	"k8s.io/node-problem-detector/pkg/types"
+)
+
+func newTestSensuLog(check, status, output string) *logtypes.Log {
+	return newTestSensuLogWithOccurrences(check, status, output, "1")
+}
+
+func newTestSensuLogWithOccurrences(check, status, output, occurrences string) *logtypes.Log {
+	return &logtypes.Log{
+		Timestamp: time.Unix(1000, 0),
+		Message:   output,
+		Fields: map[string]string{
+			sensulog.CheckField:       check,
+			sensulog.StatusField:      status,
+			sensulog.OccurrencesField: occurrences,
+		},
+	}
+}
+
+func TestSensuParseLogUsesStatus(t *testing.T) {
+	s := &SensulogMonitor{
+		checks:     newCheckStore(),
+		output:     make(chan *types.Status, 10),
+		conditions: initialConditions([]types.Condition{{Type: "SensuChecks"}}),
+	}
+	assert.NoError(t, (&s.config).ApplyConfiguration())
+
+	// The output mentions OK, but the status is critical.
+	s.parseLog(newTestSensuLog("db", "2", "CRITICAL: OK connections: 0"))
+	status := <-s.output
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	state, _ := s.checks.Get("db")
+	assert.Equal(t, CheckCritical, state.Level)
+
+	// The output mentions CRITICAL, but the status is warning.
+	s.parseLog(newTestSensuLog("db", "1", "0 CRITICAL alerts, latency high"))
+	<-s.output
+	state, _ = s.checks.Get("db")
+	assert.Equal(t, CheckWarning, state.Level)
+
+	// An OK status resolves the check.
+	s.parseLog(newTestSensuLog("db", "0", "WARN threshold not reached"))
+	status = <-s.output
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+}
+
+func TestSensuCheckConditions(t *testing.T) {
+	s := &SensulogMonitor{
+		checks: newCheckStore(),
+		output: make(chan *types.Status, 10),
+		config: SensuMonitorConfig{
+			MonitorConfig: MonitorConfig{
+				Source: testSource,
+				DefaultConditions: []types.Condition{
+					{Type: "SensuChecks", Reason: "NoFailures", Message: "All checks passed"},
+					{Type: "DiskProblem", Reason: "DiskIsFine", Message: "disk is fine"},
+					{Type: "ClockSkew", Reason: "ClockIsSynced", Message: "clock is synced"},
+				},
+			},
+			CheckConditions: []CheckCondition{
+				{Check: "disk_usage*", Condition: "DiskProblem", Reason: "DiskUsageHigh"},
+				{Check: "ntp", Condition: "ClockSkew"},
+			},
+		},
+	}
+	assert.NoError(t, (&s.config).ApplyConfiguration())
+	assert.NoError(t, s.config.Validate())
+	s.conditions = initialConditions(s.config.DefaultConditions)
+
+	s.parseLog(newTestSensuLog("disk_usage_var", "2", "/var 95% used"))
+	status := <-s.output
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+	assert.Equal(t, types.Condition{
+		Type:       "DiskProblem",
+		Status:     types.True,
+		Transition: time.Unix(1000, 0),
+		Reason:     "DiskUsageHigh",
+		Message:    "disk_usage_var: /var 95% used",
+	}, status.Conditions[1])
+	assert.Equal(t, types.False, status.Conditions[2].Status)
+
+	s.parseLog(newTestSensuLog("ntp", "1", "offset 2s"))
+	status = <-s.output
+	assert.Equal(t, types.True, status.Conditions[1].Status)
+	assert.Equal(t, "SensuCheckFailed", status.Conditions[2].Reason)
+	assert.Equal(t, "ntp: offset 2s", status.Conditions[2].Message)
+
+	s.parseLog(newTestSensuLog("memory", "2", "swap full"))
+	status = <-s.output
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, "memory: swap full", status.Conditions[0].Message)
+	assert.Equal(t, "disk_usage_var: /var 95% used", status.Conditions[1].Message)
+	assert.Equal(t, "ntp: offset 2s", status.Conditions[2].Message)
+}
+
+func TestValidateCheckConditions(t *testing.T) {
+	sc := SensuMonitorConfig{
+		CheckConditions: []CheckCondition{{Check: "ntp", Condition: "ClockSkew"}},
+	}
+	assert.Error(t, sc.Validate(), "condition must be a default condition")
+	sc.DefaultConditions = []types.Condition{{Type: "ClockSkew"}}
+	assert.NoError(t, sc.Validate())
+	sc.CheckConditions[0].Check = "ntp["
+	assert.Error(t, sc.Validate(), "check pattern must be valid")
+}
+
+func TestSensuMonitorsAreIsolated(t *testing.T) {
+	newMonitor := func() *SensulogMonitor {
+		s := &SensulogMonitor{
+			checks:     newCheckStore(),
+			output:     make(chan *types.Status, 10),
+			conditions: initialConditions([]types.Condition{{Type: "SensuChecks"}}),
+		}
+		assert.NoError(t, (&s.config).ApplyConfiguration())
+		return s
+	}
+	s1, s2 := newMonitor(), newMonitor()
+
+	s1.parseLog(newTestSensuLog("db", "2", "down"))
+	status := <-s1.output
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Len(t, status.Events, 2, "expect a check event and a condition change event")
+
+	s2.parseLog(newTestSensuLog("web", "0", "up"))
+	status = <-s2.output
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+	assert.Empty(t, s2.checks.Failed())
+	assert.Len(t, s1.checks.Failed(), 1)
+
+	// A repeated failure doesn't generate events again.
+	s1.parseLog(newTestSensuLog("db", "2", "still down"))
+	status = <-s1.output
+	assert.Empty(t, status.Events)
+	assert.Equal(t, "db: still down", status.Conditions[0].Message)
+}
+
+func TestSensuExpireChecks(t *testing.T) {
+	s := &SensulogMonitor{
+		checks: newCheckStore(),
+		output: make(chan *types.Status, 10),
+		config: SensuMonitorConfig{
+			MonitorConfig: MonitorConfig{
+				DefaultConditions: []types.Condition{{Type: "SensuChecks", Reason: "NoFailures"}},
+			},
+			StaleAfterString: "5m",
+			StaleAsUnknown:   true,
+		},
+	}
+	assert.NoError(t, (&s.config).ApplyConfiguration())
+	s.conditions = initialConditions(s.config.DefaultConditions)
+
+	s.parseLog(newTestSensuLog("db", "2", "down"))
+	<-s.output
+
+	// Nothing is stale yet.
+	s.expireChecks(time.Unix(1000, 0).Add(time.Minute))
+	assert.Len(t, s.output, 0)
+
+	s.expireChecks(time.Unix(1000, 0).Add(5 * time.Minute))
+	status := <-s.output
+	assert.Equal(t, "SensuCheckStale", status.Events[0].Reason)
+	assert.Equal(t, types.Unknown, status.Conditions[0].Status)
+
+	s.expireChecks(time.Unix(1000, 0).Add(10 * time.Minute))
+	status = <-s.output
+	assert.Equal(t, "SensuCheckExpired", status.Events[0].Reason)
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+	assert.Equal(t, "NoFailures", status.Conditions[0].Reason)
+	assert.Empty(t, s.checks.Failed())
+}
+
+func TestSensuFilterAndOccurrences(t *testing.T) {
+	s := &SensulogMonitor{
+		checks: newCheckStore(),
+		output: make(chan *types.Status, 10),
+		config: SensuMonitorConfig{
+			ExcludeChecks: []string{"noisy*"},
+		},
+	}
+	assert.NoError(t, (&s.config).ApplyConfiguration())
+	s.conditions = initialConditions([]types.Condition{{Type: "SensuChecks"}})
+
+	// Excluded checks are ignored.
+	s.parseLog(newTestSensuLog("noisy_check", "2", "down"))
+	assert.Len(t, s.output, 0)
+
+	// The check only affects the condition after failing twice in a row.
+	s.parseLog(newTestSensuLogWithOccurrences("dns", "2", "timeout", "2"))
+	status := <-s.output
+	assert.Equal(t, types.False, status.Conditions[0].Status)
+	assert.Empty(t, status.Events)
+
+	s.parseLog(newTestSensuLogWithOccurrences("dns", "2", "timeout", "2"))
+	status = <-s.output
+	assert.Equal(t, types.True, status.Conditions[0].Status)
+	assert.Equal(t, "dns: timeout", status.Conditions[0].Message)
+}
+
+func TestSensuMessageTemplates(t *testing.T) {
+	newLog := func() *logtypes.Log {
+		log := newTestSensuLog("disk_usage", "2", "disk 95% used")
+		log.Fields[sensulog.RunbookField] = "https://runbooks/disk"
+		log.Fields[sensulog.OwnerField] = "storage-team"
+		log.Fields[sensulog.ContactsField] = "storage,oncall"
+		return log
+	}
+	for desc, test := range map[string]struct {
+		eventTemplate string
+		checkTemplate string
+		event         string
+		message       string
+	}{
+		"default templates": {
+			event:   "Sensu check: disk_usage is CRITICAL, owner: storage-team, runbook: https://runbooks/disk",
+			message: "disk_usage: disk 95% used (runbook: https://runbooks/disk)",
+		},
+		"custom templates": {
+			eventTemplate: "{{.Check}} failed, contact {{.Contacts}} via {{index .Fields \"owner\"}}",
+			checkTemplate: "{{.Check}} [{{.Level}}] {{.Output}}",
+			event:         "disk_usage failed, contact storage,oncall via storage-team",
+			message:       "disk_usage [CRITICAL] disk 95% used",
+		},
+		"failed templates fall back to the defaults": {
+			eventTemplate: "{{.Unknown}}",
+			checkTemplate: "{{.Check.Unknown}}",
+			event:         "Sensu check: disk_usage is CRITICAL, owner: storage-team, runbook: https://runbooks/disk",
+			message:       "disk_usage: disk 95% used (runbook: https://runbooks/disk)",
+		},
+	} {
+		s := &SensulogMonitor{
+			checks: newCheckStore(),
+			output: make(chan *types.Status, 10),
+			config: SensuMonitorConfig{
+				EventMessageTemplate: test.eventTemplate,
+				CheckMessageTemplate: test.checkTemplate,
+			},
+		}
+		assert.NoError(t, (&s.config).ApplyConfiguration(), desc)
+		s.conditions = initialConditions([]types.Condition{{Type: "SensuChecks"}})
+
+		s.parseLog(newLog())
+		status := <-s.output
+		if assert.NotEmpty(t, status.Events, desc) {
+			assert.Equal(t, "SensuCheckFailed", status.Events[0].Reason, desc)
+			assert.Equal(t, test.event, status.Events[0].Message, desc)
+		}
+		assert.Equal(t, test.message, status.Conditions[0].Message, desc)
+	}
+	assert.Error(t, (&SensuMonitorConfig{EventMessageTemplate: "{{.Check"}).ApplyConfiguration())
+	assert.Error(t, (&SensuMonitorConfig{CheckMessageTemplate: "{{end}}"}).ApplyConfiguration())
+}
+
+func TestSensuRules(t *testing.T) {
+	s := &SensulogMonitor{
+		buffer:     NewLogBuffer(1),
+		checks:     newCheckStore(),
+		output:     make(chan *types.Status, 10),
+		conditions: initialConditions([]types.Condition{{Type: "SensuChecks"}}),
+	}
+	s.config.Rules = []logtypes.Rule{{
+		Type:    types.Temp,
+		Reason:  "DiskFull",
+		Message: "disk {{.disk}} is full",
+		Pattern: `.*(?P<disk>/dev/\w+) full.*`,
+		Fields:  map[string]string{sensulog.CheckField: "disk_.*"},
+	}}
+	s.config.IncludeChecks = []string{"disk_usage"}
+	assert.NoError(t, (&s.config).ApplyConfiguration())
+	assert.NoError(t, s.config.Validate())
+	var err error
+	s.rules, err = compileRules(s.config.Rules)
+	assert.NoError(t, err)
+
+	// The rule matches the check result, along with the check event.
+	s.parseLog(newTestSensuLog("disk_usage", "2", "CRITICAL: /dev/sda1 full"))
+	status := <-s.output
+	assert.Len(t, status.Events, 3)
+	assert.Equal(t, types.Event{
+		Severity:  types.Warn,
+		Timestamp: time.Unix(1000, 0),
+		Reason:    "DiskFull",
+		Message:   "disk /dev/sda1 is full",
+	}, status.Events[0])
+
+	// The rule is scoped by the check field.
+	s.parseLog(newTestSensuLog("raid", "2", "CRITICAL: /dev/sdb1 full"))
+	assert.Len(t, s.output, 0)
+
+	// The rule matches the results of the checks the monitor ignores as well.
+	s.parseLog(newTestSensuLog("disk_inodes", "2", "CRITICAL: /dev/sdc1 full"))
+	status = <-s.output
+	assert.Len(t, status.Events, 1)
+	assert.Equal(t, "disk /dev/sdc1 is full", status.Events[0].Message)
+}
@@ -17,8 +17,9 @@ limitations under the License.
 package types
 
 import (
-	"k8s.io/node-problem-detector/pkg/types"
 	"time"
+
+	"k8s.io/node-problem-detector/pkg/types"
 )
 
 // Log is the log item returned by translator. It's very easy to extend this
@@ -26,12 +27,10 @@ import (
 type Log struct {
 	Timestamp time.Time
 	Message   string
-}
-
-type SensuLog struct {
-	Timestamp time.Time
-	Check	  string
-	Output 	  string
+	// Fields are the optional structured fields of the log, e.g. the check name
+	// and status of a sensu check result. Log watchers producing plain log lines
+	// leave it nil.
+	Fields map[string]string
 }
 
 // Rule describes how log monitor should analyze the log.
@@ -42,9 +41,69 @@ type Rule struct {
 	// the Condition field should be set only when the problem is permanent, or
 	// else the field will be ignored.
 	Condition string `json:"condition"`
-	// Reason is the short reason of the problem.
+	// Reason is the short reason of the problem. It is a go template with the
+	// same data as the message template.
 	Reason string `json:"reason"`
+	// Message is the go template of the problem message with the named capture
+	// groups of the pattern, and the matched logs as "Message", e.g.
+	// "process {{.process}} is killed". Empty uses the matched logs.
+	Message string `json:"message,omitempty"`
+	// Annotations are the go templates of the extra annotations of the problem
+	// event, keyed by annotation name. The templates have the same data as
+	// the message template.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Severity is the severity of the problem event. It defaults to warn for
+	// temporary problems, and info for the condition change events of
+	// permanent problems.
+	Severity types.Severity `json:"severity,omitempty"`
 	// Pattern is the regular expression to match the problem in log.
 	// Notice that the pattern must match to the end of the line.
 	Pattern string `json:"pattern"`
+	// ExcludePatterns are the regular expressions to suppress the problem. The
+	// match is suppressed when any of them matches anywhere in the matched logs,
+	// e.g. to ignore known benign lines matching a broad pattern.
+	ExcludePatterns []string `json:"excludePatterns,omitempty"`
+	// Fields are the regular expressions to match the structured fields of the
+	// last matched log, keyed by field name. Each regular expression must match
+	// the whole field value. A missing field is treated as an empty value. It
+	// scopes the rule, e.g. to the journal logs of a systemd unit with
+	// {"_SYSTEMD_UNIT": "docker.service"}.
+	Fields map[string]string `json:"fields,omitempty"`
+	// MinPriority is the minimum syslog priority of the last matched log in
+	// the PRIORITY field, either a priority name, e.g. "warning", or a number
+	// from 0 (emerg) to 7 (debug). Less severe logs and logs without priority
+	// don't match, so it only applies to the log watchers setting the field,
+	// e.g. kmsg and journald.
+	MinPriority string `json:"minPriority,omitempty"`
+	// RecoveryPattern is the regular expression to match the recovery of the
+	// problem in log. When it matches, the condition the problem triggered is
+	// reset to its default reason and message. It is only valid for permanent
+	// problems.
+	RecoveryPattern string `json:"recoveryPattern,omitempty"`
+	// RecoveryFields are the regular expressions to match the structured
+	// fields of the last log matching the recovery pattern, keyed by field
+	// name, the same as Fields. It scopes the recovery, e.g. to the health
+	// logs of the log watcher. It requires the recovery pattern.
+	RecoveryFields map[string]string `json:"recoveryFields,omitempty"`
+	// RecoverAfterString is the duration string after which the condition the
+	// problem triggered is reset if the problem doesn't happen again, e.g. "30m".
+	// It is only valid for permanent problems.
+	RecoverAfterString string `json:"recoverAfter,omitempty"`
+	// RecoverAfter is the duration after which the condition the problem
+	// triggered is reset if the problem doesn't happen again.
+	RecoverAfter time.Duration `json:"-"`
+	// Count is the number of matches within the window needed to report the
+	// problem. Zero or one reports every match.
+	Count int `json:"count,omitempty"`
+	// WindowString is the duration string of the window the matches are
+	// counted in, e.g. "20m". It is required when count is larger than one.
+	WindowString string `json:"window,omitempty"`
+	// Window is the duration of the window the matches are counted in.
+	Window time.Duration `json:"-"`
+}
+
+// Recoverable checks whether the condition the problem triggered can be reset
+// by the recovery pattern or the recovery duration.
+func (r Rule) Recoverable() bool {
+	return r.RecoveryPattern != "" || r.RecoverAfter > 0
 }
@@ -26,9 +26,9 @@ import (
 // 1) The kubernetes api packages are too heavy.
 // 2) We want to make the interface independent with kubernetes api change.
 
-// Severity is the severity of the problem event. Now we only have 2 severity levels: Info and Warn,
-// which are corresponding to the current kubernetes event types. We may want to add more severity
-// levels in the future.
+// Severity is the severity of the problem event. Kubernetes only has 2 event types, so Info is
+// translated to a normal event, and the other severity levels are translated to a warning event.
+// The severity levels are kept intact in the internal event for other exporters.
 type Severity string
 
 const (
@@ -36,8 +36,22 @@ const (
 	Info Severity = "info"
 	// Warn is translated to a warning event.
 	Warn Severity = "warn"
+	// Error is translated to a warning event.
+	Error Severity = "error"
+	// Critical is translated to a warning event.
+	Critical Severity = "critical"
 )
 
+// IsValidSeverity checks whether the severity is one of the known severity levels.
+func IsValidSeverity(severity Severity) bool {
+	switch severity {
+	case Info, Warn, Error, Critical:
+		return true
+	default:
+		return false
+	}
+}
+
 // ConditionStatus is the status of the condition.
 type ConditionStatus string
 
@@ -75,6 +89,8 @@ type Event struct {
 	Reason string `json:"reason"`
 	// Message is a human readable message of why the event is generated.
 	Message string `json:"message"`
+	// Annotations are the optional extra annotations of the event.
+	Annotations map[string]string `json:"annotations,omitempty"`
 }
 
 // Status is the status other problem daemons should report to node problem detector.